@@ -0,0 +1,197 @@
+package main
+
+// Channels: making, sending to, receiving from, closing and ranging over
+// channels, in programs without goroutines
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+)
+
+// channelRuntime is the C++ code for channels. There are no other goroutines
+// that can send or receive, so a channel is a queue with a capacity, and
+// sending to a full channel or receiving from an empty channel that is not
+// closed is a deadlock, which exits with exit status 2, like in Go. Sending
+// to or closing a closed channel panics.
+const channelRuntime = `// _chan is a Go channel, which is shared by the copies of it
+template <typename T> class _chan {
+public:
+    _chan() = default;
+    _chan(std::nullptr_t) { }
+    explicit _chan(std::int64_t capacity)
+        : state(std::make_shared<_state>())
+    {
+        state->capacity = capacity;
+    }
+
+    // send adds a value to the channel
+    void send(T const& value) const
+    {
+        if (state && state->closed) {
+            throw _panic_error { "send on closed channel" };
+        }
+        if (!state || state->values.size() >= state->capacity) {
+            deadlock();
+        }
+        state->values.push_back(value);
+    }
+
+    // receive_ok returns the next value and true, or the zero value and
+    // false if the channel is closed and there are no more values
+    auto receive_ok() const -> std::tuple<T, bool>
+    {
+        if (state && !state->values.empty()) {
+            T value = state->values.front();
+            state->values.pop_front();
+            return { value, true };
+        }
+        if (!state || !state->closed) {
+            deadlock();
+        }
+        return { T {}, false };
+    }
+
+    // receive returns the next value, or the zero value if the channel is closed
+    auto receive() const -> T { return std::get<0>(receive_ok()); }
+
+    void close() const
+    {
+        if (!state) {
+            throw _panic_error { "close of nil channel" };
+        }
+        if (state->closed) {
+            throw _panic_error { "close of closed channel" };
+        }
+        state->closed = true;
+    }
+
+    auto size() const -> std::size_t { return state ? state->values.size() : 0; }
+    auto cap() const -> std::size_t { return state ? state->capacity : 0; }
+    auto operator==(std::nullptr_t) const -> bool { return !state; }
+    auto operator!=(std::nullptr_t) const -> bool { return state != nullptr; }
+
+    // Ranging over a channel receives values until the channel is closed
+    class iterator {
+    public:
+        _chan const* ch;
+        T value {};
+        bool done = false;
+        auto operator*() const -> T const& { return value; }
+        auto operator++() -> iterator&
+        {
+            next();
+            return *this;
+        }
+        auto operator!=(iterator const&) const -> bool { return !done; }
+        void next()
+        {
+            auto [v, ok] = ch->receive_ok();
+            value = v;
+            done = !ok;
+        }
+    };
+    auto begin() const -> iterator
+    {
+        iterator it { this };
+        it.next();
+        return it;
+    }
+    auto end() const -> iterator { return iterator { this, T {}, true }; }
+
+private:
+    struct _state {
+        std::deque<T> values;
+        std::size_t capacity = 0;
+        bool closed = false;
+    };
+    std::shared_ptr<_state> state;
+
+    // deadlock exits with exit status 2, without making the deferred function calls, like in Go
+    [[noreturn]] static void deadlock()
+    {
+        std::cout.flush();
+        std::cerr << "fatal error: all goroutines are asleep - deadlock!" << std::endl;
+        std::exit(2);
+    }
+};
+
+// _close closes a channel
+template <typename T> inline void _close(_chan<T> const& ch) { ch.close(); }`
+
+// channelEdits returns the edits that transform the channel operations in a
+// line of Go code:
+// * make(chan T, n) is transformed to _chan<T>(n)
+// * ch <- v is transformed to ch.send(v)
+// * <-ch is transformed to ch.receive(), or to ch.receive_ok() for v, ok := <-ch
+func channelEdits(line string, file *ast.File, offset func(token.Pos) int) []edit {
+	var edits []edit
+	text := func(n ast.Node) string {
+		return line[offset(n.Pos()):offset(n.End())]
+	}
+	// The receive operations that also give if a value was received
+	commaOk := commaOkValues(file)
+	receiver := func(x ast.Expr) {
+		switch x.(type) {
+		case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr, *ast.CallExpr, *ast.ParenExpr:
+		default:
+			edits = append(edits, edit{offset(x.Pos()), offset(x.Pos()), "("}, edit{offset(x.End()), offset(x.End()), ")"})
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.CallExpr:
+			fun, ok := x.Fun.(*ast.Ident)
+			if !ok || fun.Name != "make" || len(x.Args) == 0 {
+				break
+			}
+			if chanType, ok := x.Args[0].(*ast.ChanType); ok {
+				cppType := "_chan<" + TypeReplace(text(chanType.Value)) + ">"
+				if len(x.Args) == 1 {
+					// An unbuffered channel
+					edits = append(edits, edit{offset(x.Pos()), offset(x.End()), cppType + "(0)"})
+				} else {
+					edits = append(edits, edit{offset(x.Pos()), offset(x.Args[1].Pos()), cppType + "("})
+				}
+			}
+		case *ast.SendStmt:
+			receiver(x.Chan)
+			edits = append(edits, edit{offset(x.Chan.End()), offset(x.Value.Pos()), ".send("}, edit{offset(x.End()), offset(x.End()), ")"})
+		case *ast.UnaryExpr:
+			if x.Op != token.ARROW {
+				break
+			}
+			receive := ".receive()"
+			if commaOk[x] {
+				receive = ".receive_ok()"
+			}
+			edits = append(edits, edit{offset(x.OpPos), offset(x.X.Pos()), ""}, edit{offset(x.End()), offset(x.End()), receive})
+			// The edits that are added later at the same position come first
+			receiver(x.X)
+		}
+		return true
+	})
+	return edits
+}
+
+// SelectStatements reports the first select statement in the given Go
+// program, like the Go compiler reports errors, and exits. There are no
+// other goroutines that a select statement could wait for, and select
+// statements are not supported.
+func SelectStatements(source string) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, 0)
+	if err != nil {
+		return
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if x, ok := n.(*ast.SelectStmt); ok {
+			pos := fset.Position(x.Pos())
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: select statements are not supported\n", sourceFilename, pos.Line, pos.Column)
+			os.Exit(1)
+		}
+		return true
+	})
+}
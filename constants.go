@@ -0,0 +1,558 @@
+package main
+
+// Evaluation of constant expressions, with the same precision as the Go compiler
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// typedConstant is a constant value, together with its Go type.
+// The type is an empty string for untyped constants.
+type typedConstant struct {
+	value  constant.Value
+	goType string
+}
+
+var (
+	// Package level constants that have been declared so far, by name
+	constants = map[string]typedConstant{}
+
+	// Constants that have been declared so far in functions, by name and
+	// the line they are declared on
+	localConstants = map[variable]typedConstant{}
+
+	// The underlying Go types of the type declarations encountered so far, by name
+	underlyingTypes = map[string]string{}
+
+	// Constants from the standard library, as given in the Go source code
+	libraryConstants = map[string]string{
+		"math.E":                      "2.71828182845904523536028747135266249775724709369995957496696763",
+		"math.Pi":                     "3.14159265358979323846264338327950288419716939937510582097494459",
+		"math.Phi":                    "1.61803398874989484820458683436563811772030917980576286213544862",
+		"math.Sqrt2":                  "1.41421356237309504880168872420969807856967187537694807317667974",
+		"math.SqrtE":                  "1.64872127070012814684865078831848402231098255750451052474413224",
+		"math.SqrtPi":                 "1.77245385090551602729816748334114518279754945612238712821380779",
+		"math.SqrtPhi":                "1.27201964951406896425242246173749149171560804184009624861664038",
+		"math.Ln2":                    "0.693147180559945309417232121458176568075500134360255254120680009",
+		"math.Ln10":                   "2.30258509299404568401799145468436420760110148862877297603332790",
+		"math.MaxFloat32":             "0x1p127 * (1 + (1 - 0x1p-23))",
+		"math.SmallestNonzeroFloat32": "0x1p-126 * 0x1p-23",
+		"math.MaxFloat64":             "0x1p1023 * (1 + (1 - 0x1p-52))",
+		"math.SmallestNonzeroFloat64": "0x1p-1022 * 0x1p-52",
+		"math.MaxInt":                 "1<<63 - 1",
+		"math.MinInt":                 "-1 << 63",
+		"math.MaxInt8":                "1<<7 - 1",
+		"math.MinInt8":                "-1 << 7",
+		"math.MaxInt16":               "1<<15 - 1",
+		"math.MinInt16":               "-1 << 15",
+		"math.MaxInt32":               "1<<31 - 1",
+		"math.MinInt32":               "-1 << 31",
+		"math.MaxInt64":               "1<<63 - 1",
+		"math.MinInt64":               "-1 << 63",
+		"math.MaxUint":                "1<<64 - 1",
+		"math.MaxUint8":               "1<<8 - 1",
+		"math.MaxUint16":              "1<<16 - 1",
+		"math.MaxUint32":              "1<<32 - 1",
+		"math.MaxUint64":              "1<<64 - 1",
+	}
+
+	errNotConstant = errors.New("not a constant expression")
+)
+
+// intRange returns the bit size and signedness of the given Go integer type.
+// Returns 0 as the bit size if the type is not an integer type.
+func intRange(goType string) (int, bool) {
+	switch goType {
+	case "int", "int64":
+		return 64, true
+	case "int32", "rune":
+		return 32, true
+	case "int16":
+		return 16, true
+	case "int8":
+		return 8, true
+	case "uint", "uint64", "uintptr":
+		return 64, false
+	case "uint32":
+		return 32, false
+	case "uint16":
+		return 16, false
+	case "uint8", "byte":
+		return 8, false
+	}
+	return 0, false
+}
+
+// underlyingType follows type declarations until a predeclared Go type is found
+func underlyingType(goType string) string {
+	for i := 0; i < 100; i++ {
+		underlying, ok := underlyingTypes[goType]
+		if !ok {
+			break
+		}
+		goType = underlying
+	}
+	return goType
+}
+
+// defaultType returns the default Go type of an untyped constant
+func defaultType(v constant.Value) string {
+	switch v.Kind() {
+	case constant.Bool:
+		return "bool"
+	case constant.String:
+		return "string"
+	case constant.Int:
+		return "int"
+	case constant.Float:
+		return "float64"
+	case constant.Complex:
+		return "complex128"
+	}
+	return ""
+}
+
+// untypedLiteralType returns the Go type of the literal for an untyped
+// constant, or an error if it is too large for any type. Integers that are
+// too large for an int may still be used as an uint64.
+func untypedLiteralType(v constant.Value) (string, error) {
+	literalType := defaultType(v)
+	if _, err := representable(v, literalType); err != nil && literalType == "int" {
+		literalType = "uint64"
+	}
+	if _, err := representable(v, literalType); err != nil {
+		return "", err
+	}
+	return literalType, nil
+}
+
+// representable converts the given constant value to the given Go type,
+// or returns an error with the same wording as the Go compiler if it does not fit.
+func representable(v constant.Value, goType string) (constant.Value, error) {
+	underlying := underlyingType(goType)
+	if bits, signed := intRange(underlying); bits > 0 {
+		i := constant.ToInt(v)
+		if i.Kind() != constant.Int {
+			if v.Kind() == constant.Float || v.Kind() == constant.Complex {
+				return nil, fmt.Errorf("constant %s truncated to integer", v)
+			}
+			return nil, fmt.Errorf("cannot convert %s to type %s", v, goType)
+		}
+		var min, max constant.Value
+		if signed {
+			min = constant.Shift(constant.MakeInt64(-1), token.SHL, uint(bits-1))
+			max = constant.BinaryOp(constant.Shift(constant.MakeInt64(1), token.SHL, uint(bits-1)), token.SUB, constant.MakeInt64(1))
+		} else {
+			min = constant.MakeInt64(0)
+			max = constant.BinaryOp(constant.Shift(constant.MakeInt64(1), token.SHL, uint(bits)), token.SUB, constant.MakeInt64(1))
+		}
+		if constant.Compare(i, token.LSS, min) || constant.Compare(i, token.GTR, max) {
+			return nil, fmt.Errorf("constant %s overflows %s", i, goType)
+		}
+		return i, nil
+	}
+	switch underlying {
+	case "float32", "float64":
+		f := constant.ToFloat(v)
+		if f.Kind() != constant.Float && f.Kind() != constant.Int {
+			return nil, fmt.Errorf("cannot convert %s to type %s", v, goType)
+		}
+		if x, _ := constant.Float64Val(f); math.IsInf(x, 0) || (underlying == "float32" && math.IsInf(float64(float32(x)), 0)) {
+			return nil, fmt.Errorf("constant %s overflows %s", v, goType)
+		}
+		return constant.ToFloat(f), nil
+	case "complex64", "complex128":
+		c := constant.ToComplex(v)
+		if c.Kind() != constant.Complex {
+			return nil, fmt.Errorf("cannot convert %s to type %s", v, goType)
+		}
+		return c, nil
+	case "string":
+		if v.Kind() != constant.String {
+			return nil, fmt.Errorf("cannot convert %s to type %s", v, goType)
+		}
+	case "bool":
+		if v.Kind() != constant.Bool {
+			return nil, fmt.Errorf("cannot convert %s to type %s", v, goType)
+		}
+	}
+	return v, nil
+}
+
+// lookupConstant returns the constant with the given name that is in scope
+// on the line that is being transformed. A local variable or constant
+// shadows the package level constant with the same name.
+func lookupConstant(name string) (typedConstant, bool) {
+	if f := currentFunction(currentLine); f != nil {
+		found, declared := false, 0
+		for _, d := range f.declarations {
+			// A constant is in scope after its specification
+			if d.name == name && d.line < currentLine && d.first <= currentLine && currentLine <= d.last {
+				found, declared = true, d.line
+			}
+		}
+		if found {
+			c, ok := localConstants[variable{name, declared}]
+			return c, ok
+		}
+	}
+	c, ok := constants[name]
+	return c, ok
+}
+
+// EvalConstant evaluates a Go constant expression, using the constants that
+// have been declared so far. Returns errNotConstant if the expression can not be
+// evaluated at compile time, or an error if the expression is not valid Go.
+func EvalConstant(source string) (typedConstant, error) {
+	expr, err := parser.ParseExpr(source)
+	if err != nil {
+		return typedConstant{}, errNotConstant
+	}
+	return evalConstant(expr)
+}
+
+func evalConstant(expr ast.Expr) (typedConstant, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return typedConstant{constant.MakeFromLiteral(e.Value, e.Kind, 0), ""}, nil
+	case *ast.ParenExpr:
+		return evalConstant(e.X)
+	case *ast.Ident:
+		switch e.Name {
+		case "true", "false":
+			return typedConstant{constant.MakeBool(e.Name == "true"), ""}, nil
+		case "iota":
+			return typedConstant{constant.MakeInt64(int64(iotaNumber)), ""}, nil
+		}
+		if c, ok := lookupConstant(e.Name); ok {
+			return c, nil
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok {
+			if literal, ok := libraryConstants[pkg.Name+"."+e.Sel.Name]; ok {
+				return EvalConstant(literal)
+			}
+		}
+	case *ast.UnaryExpr:
+		x, err := evalConstant(e.X)
+		if err != nil {
+			return x, err
+		}
+		var prec uint
+		if bits, signed := intRange(underlyingType(x.goType)); bits > 0 && !signed {
+			// ^x for unsigned types only flips the bits that are within the type
+			prec = uint(bits)
+		}
+		if e.Op == token.XOR && x.value.Kind() != constant.Int {
+			return x, fmt.Errorf("invalid operation: operator ^ not defined on %s", x.value)
+		}
+		return typedConstant{constant.UnaryOp(e.Op, x.value, prec), x.goType}, nil
+	case *ast.BinaryExpr:
+		x, err := evalConstant(e.X)
+		if err != nil {
+			return x, err
+		}
+		y, err := evalConstant(e.Y)
+		if err != nil {
+			return y, err
+		}
+		switch e.Op {
+		case token.SHL, token.SHR:
+			s, ok := constant.Uint64Val(constant.ToInt(y.value))
+			if !ok {
+				return x, fmt.Errorf("invalid shift count %s", y.value)
+			}
+			xi := constant.ToInt(x.value)
+			if xi.Kind() != constant.Int {
+				return x, fmt.Errorf("invalid operation: shifted operand %s must be integer", x.value)
+			}
+			return typedConstant{constant.Shift(xi, e.Op, uint(s)), x.goType}, nil
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return typedConstant{constant.MakeBool(constant.Compare(x.value, e.Op, y.value)), ""}, nil
+		}
+		goType := x.goType
+		if goType == "" {
+			goType = y.goType
+		}
+		op := e.Op
+		if op == token.QUO && x.value.Kind() == constant.Int && y.value.Kind() == constant.Int {
+			// Integer division
+			op = token.QUO_ASSIGN
+		}
+		if op == token.AND_NOT {
+			// x &^ y is the same as x & ^y
+			y.value = constant.UnaryOp(token.XOR, y.value, 0)
+			op = token.AND
+		}
+		if (op == token.QUO || op == token.QUO_ASSIGN || op == token.REM) && constant.Sign(y.value) == 0 {
+			return x, errors.New("invalid operation: division by zero")
+		}
+		result := constant.BinaryOp(x.value, op, y.value)
+		if goType != "" {
+			// Operations on typed integer constants must stay within the type
+			if bits, _ := intRange(underlyingType(goType)); bits > 0 {
+				result = constant.ToInt(result)
+			}
+		}
+		return typedConstant{result, goType}, nil
+	case *ast.CallExpr:
+		// Conversions, like float64(x), and the len builtin for strings
+		fun, ok := e.Fun.(*ast.Ident)
+		if !ok || len(e.Args) == 0 || (len(e.Args) > 1 && fun.Name != "complex") {
+			break
+		}
+		x, err := evalConstant(e.Args[0])
+		if err != nil {
+			return x, err
+		}
+		if fun.Name == "complex" && len(e.Args) == 2 {
+			y, err := evalConstant(e.Args[1])
+			if err != nil {
+				return y, err
+			}
+			goType := "complex128"
+			if underlyingType(x.goType) == "float32" && underlyingType(y.goType) == "float32" {
+				goType = "complex64"
+			} else if x.goType == "" && y.goType == "" {
+				goType = ""
+			}
+			im := constant.BinaryOp(constant.ToFloat(y.value), token.MUL, constant.MakeImag(constant.MakeInt64(1)))
+			return typedConstant{constant.BinaryOp(constant.ToFloat(x.value), token.ADD, im), goType}, nil
+		}
+		if fun.Name == "real" || fun.Name == "imag" {
+			goType := "float64"
+			if underlyingType(x.goType) == "complex64" {
+				goType = "float32"
+			} else if x.goType == "" {
+				goType = ""
+			}
+			if fun.Name == "real" {
+				return typedConstant{constant.ToFloat(constant.Real(x.value)), goType}, nil
+			}
+			return typedConstant{constant.ToFloat(constant.Imag(x.value)), goType}, nil
+		}
+		if fun.Name == "len" && x.value.Kind() == constant.String {
+			return typedConstant{constant.MakeInt64(int64(len(constant.StringVal(x.value)))), "int"}, nil
+		}
+		if underlying := underlyingType(fun.Name); underlying == "string" || underlying == "bool" || underlying == "float32" || underlying == "float64" || func() bool { bits, _ := intRange(underlying); return bits > 0 }() {
+			if underlying == "string" && x.value.Kind() == constant.Int {
+				// string(rune)
+				r, _ := constant.Int64Val(x.value)
+				return typedConstant{constant.MakeString(string(rune(r))), fun.Name}, nil
+			}
+			v, err := representable(x.value, fun.Name)
+			if err != nil {
+				return x, err
+			}
+			return typedConstant{v, fun.Name}, nil
+		}
+	}
+	return typedConstant{}, errNotConstant
+}
+
+// SplitExpressions splits a comma separated list of Go expressions
+func SplitExpressions(source string) []string {
+	expr, err := parser.ParseExpr("f(" + source + ")")
+	if err != nil {
+		return SplitArgs(source)
+	}
+	var expressions []string
+	for _, arg := range expr.(*ast.CallExpr).Args {
+		// Subtract the length of "f(" and the 1-based offset
+		expressions = append(expressions, source[arg.Pos()-3:arg.End()-3])
+	}
+	return expressions
+}
+
+// cppQuote returns a C++ string literal for the given string
+func cppQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			sb.WriteByte(c)
+		default:
+			// Octal escapes are at most three digits long, unlike hexadecimal escapes
+			sb.WriteString(fmt.Sprintf("\\%03o", c))
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// ConstantLiteral returns a C++ literal for the given constant, which must
+// already be representable by the given Go type.
+func ConstantLiteral(v constant.Value, goType string) string {
+	switch v.Kind() {
+	case constant.Bool:
+		return strconv.FormatBool(constant.BoolVal(v))
+	case constant.String:
+		return cppQuote(constant.StringVal(v))
+	case constant.Int:
+		if i, ok := constant.Int64Val(v); ok {
+			if i == math.MinInt64 {
+				// The C++ literal 9223372036854775808 does not fit in a signed integer
+				return "(-9223372036854775807 - 1)"
+			}
+			return strconv.FormatInt(i, 10)
+		}
+		return v.ExactString() + "u"
+	case constant.Float:
+		if underlyingType(goType) == "float32" {
+			f, _ := constant.Float32Val(v)
+			return strconv.FormatFloat(float64(f), 'g', -1, 32) + "f"
+		}
+		f, _ := constant.Float64Val(v)
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case constant.Complex:
+		if underlyingType(goType) == "complex64" {
+			return "std::complex<float>(" + ConstantLiteral(constant.ToFloat(constant.Real(v)), "float32") + ", " + ConstantLiteral(constant.ToFloat(constant.Imag(v)), "float32") + ")"
+		}
+		return "std::complex<double>(" + ConstantLiteral(constant.ToFloat(constant.Real(v)), "") + ", " + ConstantLiteral(constant.ToFloat(constant.Imag(v)), "") + ")"
+	}
+	return v.ExactString()
+}
+
+// ConstantType returns the C++ type for a constant of the given Go type
+func ConstantType(goType string) string {
+	if goType == "string" {
+		// String constants are C strings
+		return "auto"
+	}
+	return TypeReplace(goType)
+}
+
+// usesLargeConstant checks if the given Go expression uses an untyped
+// constant that is too large for any type
+func usesLargeConstant(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if c, ok := lookupConstant(id.Name); ok && c.goType == "" {
+				if _, err := untypedLiteralType(c.value); err != nil {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// mentionsLargeConstant checks if the given line of Go code has the name of
+// an untyped constant that is too large for any type
+func mentionsLargeConstant(line string) bool {
+	for _, t := range tokens(line) {
+		if t.tok == token.IDENT && usesLargeConstant(ast.NewIdent(line[t.pos:t.end])) {
+			return true
+		}
+	}
+	return false
+}
+
+// foldConstants replaces the constant expressions that use untyped constants
+// that are too large for any type, like Big >> 98, by their values. Such
+// constants are only comments in the C++ code.
+func (e *lineEditor) foldConstants(root ast.Node) {
+	// The values of variable declarations with a type are converted to that type
+	declaredTypes := map[ast.Expr]ast.Expr{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.ValueSpec); ok && spec.Type != nil {
+			for _, value := range spec.Values {
+				declaredTypes[value] = spec.Type
+			}
+		}
+		return true
+	})
+	ast.Inspect(root, func(n ast.Node) bool {
+		expr, ok := n.(ast.Expr)
+		if !ok || !e.inLine(expr) || !usesLargeConstant(expr) {
+			return true
+		}
+		c, err := evalConstant(expr)
+		if err != nil {
+			// A part of the expression may still be constant
+			return true
+		}
+		literal := ""
+		if declared, ok := declaredTypes[expr]; ok && c.goType == "" {
+			goType := e.text(declared)
+			v, err := representable(c.value, goType)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error in \"%s\": cannot use %s (untyped %s constant %s) as %s value in variable declaration (overflows)\n", e.line, e.text(expr), strings.ToLower(c.value.Kind().String()), c.value.ExactString(), goType)
+				os.Exit(1)
+			}
+			literal = ConstantLiteral(v, goType)
+		} else if c.goType == "" {
+			if _, err := untypedLiteralType(c.value); err != nil {
+				fmt.Fprintf(os.Stderr, "error in \"%s\": %s (untyped %s constant %s) overflows %s\n", e.line, e.text(expr), strings.ToLower(c.value.Kind().String()), c.value.ExactString(), defaultType(c.value))
+				os.Exit(1)
+			}
+			literal = ConstantLiteral(c.value, "")
+		} else {
+			v, err := representable(c.value, c.goType)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error in \"%s\": %s\n", e.line, err)
+				os.Exit(1)
+			}
+			literal = TypeReplace(c.goType) + "(" + ConstantLiteral(v, c.goType) + ")"
+		}
+		// The edits within the expression are replaced too
+		e.render(e.offset(expr.Pos()), e.offset(expr.End()))
+		e.replace(expr, literal)
+		return false
+	})
+}
+
+// integerConstants replaces the untyped float constants that are used where
+// an integer is needed, like F in xs[F] and 1 << F, by their integer values
+func (e *lineEditor) integerConstants(root ast.Node) {
+	variables := currentVariables()
+	integer := func(expr ast.Expr) {
+		if expr == nil || !e.inLine(expr) {
+			return
+		}
+		c, err := evalConstant(expr)
+		if err != nil || c.goType != "" || c.value.Kind() != constant.Float {
+			return
+		}
+		if v, err := representable(c.value, "int"); err == nil {
+			e.replaceAll(expr, v.ExactString())
+		}
+	}
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.IndexExpr:
+			if !strings.HasPrefix(underlyingType(typeOf(x.X, e.text, variables)), "map[") {
+				integer(x.Index)
+			}
+		case *ast.SliceExpr:
+			integer(x.Low)
+			integer(x.High)
+			integer(x.Max)
+		case *ast.BinaryExpr:
+			if x.Op == token.SHL || x.Op == token.SHR {
+				integer(x.Y)
+			}
+		}
+		return true
+	})
+}
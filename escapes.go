@@ -0,0 +1,671 @@
+package main
+
+// Escape analysis: the values that are allocated in a function are kept on
+// the stack, unless a pointer to them may outlive the function or their scope
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+)
+
+// allocation is a place in the Go code where a value is allocated: a local
+// variable that has its address taken or is used by a closure, &T{...} or new(T)
+type allocation struct {
+	pos         token.Position
+	description string      // like x, &Node{...} or new(int)
+	object      *ast.Object // the variable, if the address of a variable is taken
+	storage     *ast.Ident  // the variable that is declared with the pointer as its value, if any
+	reason      string      // why the value is placed on the heap, or an empty string
+	temporary   bool        // the value is only used while the expression is evaluated
+}
+
+// variable is a local variable, by name and the line it is declared on
+type variable struct {
+	name string
+	line int
+}
+
+var (
+	// The allocations of &T{...} and new(T) in the functions, in the order of their positions
+	allocations []*allocation
+
+	// The local variables that have their address taken and are moved to the heap
+	heapVariables = map[variable]bool{}
+
+	// The local pointer variables that are declared with the address of a new value on the stack
+	stackPointers = map[variable]bool{}
+
+	// Print the escape analysis decisions to stderr, with the positions in the Go code
+	explainEscapes bool
+
+	// The name of the Go source file, for the positions in the messages
+	sourceFilename string
+)
+
+// escapeGraph is the flow of pointers between the variables in the functions
+type escapeGraph struct {
+	file      *ast.File
+	fset      *token.FileSet
+	text      func(ast.Node) string
+	variables map[string]string        // the Go types of the variables that are in scope
+	leaks     map[*ast.Object][]bool   // the parameters of the functions that may outlive a call
+	receivers map[string]bool          // the pointer receivers that may outlive a call, by T.M
+	flows     map[any][]any            // from variables, allocations and closures to variables, closures and reasons
+	sites     map[ast.Node]*allocation // the allocations, by the &x, &T{...} or new(T) expression
+	addressed map[*ast.Object]*allocation
+	results   map[*ast.Object]bool
+	captured  map[*ast.Object]bool // the variables that are used by closures
+	fixed     map[*ast.Object]bool // the loop variables and the receivers, which are not moved to the heap
+	scopes    []ast.Node
+}
+
+// isAllocation checks if the given node is &T{...} or new(T)
+func isAllocation(n ast.Node) bool {
+	switch x := n.(type) {
+	case *ast.UnaryExpr:
+		lit, ok := x.X.(*ast.CompositeLit)
+		return ok && x.Op == token.AND && lit.Type != nil
+	case *ast.CallExpr:
+		fun, ok := x.Fun.(*ast.Ident)
+		return ok && fun.Name == "new" && len(x.Args) == 1
+	}
+	return false
+}
+
+// allocationDescription returns a description of &T{...} or new(T), like the Go compiler gives
+func allocationDescription(n ast.Node, text func(ast.Node) string) string {
+	if x, ok := n.(*ast.UnaryExpr); ok {
+		return "&" + text(x.X.(*ast.CompositeLit).Type) + "{...}"
+	}
+	return "new(" + text(n.(*ast.CallExpr).Args[0]) + ")"
+}
+
+// within checks if the scope a is the same as or nested in the scope b
+func within(a, b ast.Node) bool {
+	return a.Pos() >= b.Pos() && a.End() <= b.End()
+}
+
+// scope returns the innermost block, statement or function that the given position is in
+func (g *escapeGraph) scope(pos token.Pos) ast.Node {
+	var innermost ast.Node
+	for _, s := range g.scopes {
+		if s.Pos() <= pos && pos < s.End() && (innermost == nil || within(s, innermost)) {
+			innermost = s
+		}
+	}
+	return innermost
+}
+
+// local returns the local variable that the given identifier refers to, or nil
+func (g *escapeGraph) local(id *ast.Ident) *ast.Object {
+	if id.Obj == nil || id.Obj.Kind != ast.Var || g.file.Scope.Lookup(id.Name) == id.Obj {
+		return nil
+	}
+	return id.Obj
+}
+
+// flow adds that the pointers in the value of the given expression may be
+// stored in the given variable, or escape for the given reason
+func (g *escapeGraph) flow(expr ast.Expr, to any) {
+	if to == nil {
+		return
+	}
+	for _, from := range g.sources(expr) {
+		g.flows[from] = append(g.flows[from], to)
+	}
+}
+
+// site returns the allocation for the given &x, &T{...} or new(T)
+// expression, or nil if x is not a local variable that can be moved
+func (g *escapeGraph) site(n ast.Node, object *ast.Object) *allocation {
+	if a, ok := g.sites[n]; ok {
+		return a
+	}
+	var a *allocation
+	if object == nil {
+		a = &allocation{pos: g.fset.Position(n.Pos()), description: allocationDescription(n, g.text)}
+	} else if !g.fixed[object] && !g.results[object] {
+		if a = g.addressed[object]; a == nil {
+			a = &allocation{pos: g.fset.Position(objectPos(object)), description: object.Name, object: object}
+			g.addressed[object] = a
+		}
+	}
+	g.sites[n] = a
+	return a
+}
+
+// sources returns the variables and the allocations that the pointers in
+// the value of the given expression may point to
+func (g *escapeGraph) sources(expr ast.Expr) []any {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		if object := g.local(x); object != nil {
+			return []any{object}
+		}
+	case *ast.ParenExpr:
+		return g.sources(x.X)
+	case *ast.KeyValueExpr:
+		return g.sources(x.Value)
+	case *ast.TypeAssertExpr:
+		return g.sources(x.X)
+	case *ast.UnaryExpr:
+		if x.Op != token.AND {
+			break
+		}
+		if lit, ok := x.X.(*ast.CompositeLit); ok && lit.Type != nil {
+			a := g.site(x, nil)
+			// The values in a new value on the heap are not followed
+			g.flow(lit, "stored in "+a.description)
+			return []any{a}
+		}
+		return g.address(x, x.X)
+	case *ast.SelectorExpr:
+		goType := typeOf(x.X, g.text, g.variables)
+		if m, ok := findMethod(goType, x.Sel.Name); ok && m.pointer && !strings.HasPrefix(goType, "*") {
+			// A method value holds a pointer to its receiver
+			return g.address(x, x.X)
+		}
+		if !strings.HasPrefix(goType, "*") {
+			// A field of a struct value
+			return g.sources(x.X)
+		}
+	case *ast.IndexExpr:
+		if t := underlyingType(typeOf(x.X, g.text, g.variables)); !strings.HasPrefix(t, "[]") && !strings.HasPrefix(t, "map[") {
+			// An element of an array value
+			return g.sources(x.X)
+		}
+	case *ast.SliceExpr:
+		if t := underlyingType(typeOf(x.X, g.text, g.variables)); !strings.HasPrefix(t, "[]") && t != "string" {
+			// Slicing an array takes its address
+			return g.address(x, x.X)
+		}
+	case *ast.FuncLit:
+		return []any{x}
+	case *ast.CompositeLit:
+		t := ""
+		if x.Type != nil {
+			t = underlyingType(g.text(x.Type))
+		}
+		var result []any
+		for _, elt := range x.Elts {
+			if strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[") {
+				g.flow(elt, "stored in a slice or a map")
+			} else {
+				result = append(result, g.sources(elt)...)
+			}
+		}
+		return result
+	case *ast.CallExpr:
+		if isAllocation(x) {
+			return []any{g.site(x, nil)}
+		}
+		if g.conversion(x) && len(x.Args) == 1 {
+			return g.sources(x.Args[0])
+		}
+	}
+	return nil
+}
+
+// address returns the allocation that the address of the given operand
+// refers to, where n is the expression that takes the address
+func (g *escapeGraph) address(n ast.Node, operand ast.Expr) []any {
+	switch x := operand.(type) {
+	case *ast.Ident:
+		if object := g.local(x); object != nil {
+			if a := g.site(n, object); a != nil {
+				return []any{a}
+			}
+		}
+	case *ast.ParenExpr:
+		return g.address(n, x.X)
+	case *ast.StarExpr:
+		// &*p is p
+		return g.sources(x.X)
+	case *ast.SelectorExpr:
+		if strings.HasPrefix(typeOf(x.X, g.text, g.variables), "*") {
+			// The address of a field of the value that p points to is in the same value
+			return g.sources(x.X)
+		}
+		return g.address(n, x.X)
+	case *ast.IndexExpr:
+		if t := underlyingType(typeOf(x.X, g.text, g.variables)); strings.HasPrefix(t, "[") && !strings.HasPrefix(t, "[]") {
+			return g.address(n, x.X)
+		}
+		return g.sources(x.X)
+	}
+	return nil
+}
+
+// target returns the variable that a value that is assigned to the given
+// expression is stored in, or the reason why the value escapes
+func (g *escapeGraph) target(expr ast.Expr) any {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		if x.Name == "_" {
+			return nil
+		}
+		object := g.local(x)
+		if object == nil {
+			return "assigned to a package variable"
+		} else if g.results[object] {
+			return "returned"
+		}
+		return object
+	case *ast.ParenExpr:
+		return g.target(x.X)
+	case *ast.SelectorExpr:
+		if t := typeOf(x.X, g.text, g.variables); t != "" && !strings.HasPrefix(t, "*") {
+			// A field of a struct value
+			return g.target(x.X)
+		}
+	case *ast.IndexExpr:
+		t := underlyingType(typeOf(x.X, g.text, g.variables))
+		if strings.HasPrefix(t, "[") && !strings.HasPrefix(t, "[]") {
+			// An element of an array value
+			return g.target(x.X)
+		} else if strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[") {
+			return "stored in a slice or a map"
+		}
+	}
+	return "stored through a pointer"
+}
+
+// conversion checks if the given call is a type conversion
+func (g *escapeGraph) conversion(call *ast.CallExpr) bool {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		if fun.Obj != nil {
+			return fun.Obj.Kind == ast.Typ
+		}
+		_, ok := types.Universe.Lookup(fun.Name).(*types.TypeName)
+		return ok
+	case *ast.ParenExpr, *ast.ArrayType, *ast.MapType, *ast.FuncType, *ast.ChanType, *ast.InterfaceType, *ast.StructType:
+		return true
+	}
+	return false
+}
+
+// call adds the flows of the arguments of a function call
+func (g *escapeGraph) call(call *ast.CallExpr) {
+	if isAllocation(call) || g.conversion(call) {
+		return
+	}
+	name := g.text(call.Fun)
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+		goType := typeOf(sel.X, g.text, g.variables)
+		if m, ok := findMethod(goType, sel.Sel.Name); ok && m.pointer && g.receivers[strings.TrimPrefix(goType, "*")+"."+m.name] {
+			// The method is given a pointer to the receiver, which may outlive the call
+			if strings.HasPrefix(goType, "*") {
+				g.flow(sel.X, "passed to "+name)
+			} else {
+				for _, from := range g.address(sel, sel.X) {
+					g.flows[from] = append(g.flows[from], "passed to "+name)
+				}
+			}
+		}
+	}
+	if fun, ok := call.Fun.(*ast.Ident); ok && fun.Obj == nil {
+		switch fun.Name {
+		case "len", "cap", "complex", "real", "imag", "min", "max", "print", "println":
+			return
+		case "append":
+			for _, arg := range call.Args[1:] {
+				g.flow(arg, "appended to a slice")
+			}
+			return
+		}
+	} else if ok && fun.Obj.Kind == ast.Fun {
+		// Only the arguments for the parameters that may outlive the call escape
+		if leaks, ok := g.leaks[fun.Obj]; ok {
+			for i, arg := range call.Args {
+				if leaks[min(i, len(leaks)-1)] {
+					g.flow(arg, "passed to "+name)
+				}
+			}
+			return
+		}
+	}
+	for _, arg := range call.Args {
+		g.flow(arg, "passed to "+name)
+	}
+}
+
+// function adds the flows in the given function body
+func (g *escapeGraph) function(body *ast.BlockStmt, f *function) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n != nil {
+			// The variables that are in scope where the node is
+			g.variables = f.variables(g.fset.Position(n.Pos()).Line - 1)
+		}
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			// The variables that are used by a closure are used where the
+			// closure is used, which may be after the function returns
+			ast.Inspect(x.Body, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok {
+					if object := g.local(id); object != nil && !within(g.scope(objectPos(object)), x) && !g.captured[object] {
+						g.flows[object] = append(g.flows[object], x)
+						g.captured[object] = true
+						if a := g.site(id, object); a != nil {
+							// The closure refers to the variable, not to a copy of it
+							g.flows[a] = append(g.flows[a], x)
+						}
+					}
+				}
+				return true
+			})
+			if x.Type.Results != nil {
+				for _, field := range x.Type.Results.List {
+					for _, id := range field.Names {
+						g.results[id.Obj] = true
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			if x.Tok != token.DEFINE && x.Tok != token.ASSIGN || len(x.Lhs) != len(x.Rhs) {
+				break
+			}
+			for i, left := range x.Lhs {
+				g.flow(x.Rhs[i], g.target(left))
+			}
+			if id, ok := x.Lhs[0].(*ast.Ident); ok && x.Tok == token.DEFINE && len(x.Lhs) == 1 {
+				g.declaration(id, x.Rhs[0])
+			}
+		case *ast.ValueSpec:
+			if len(x.Names) != len(x.Values) {
+				break
+			}
+			for i, id := range x.Names {
+				g.flow(x.Values[i], g.target(id))
+			}
+			if len(x.Names) == 1 {
+				g.declaration(x.Names[0], x.Values[0])
+			}
+		case *ast.ReturnStmt:
+			for _, result := range x.Results {
+				g.flow(result, "returned")
+			}
+		case *ast.RangeStmt:
+			for _, e := range []ast.Expr{x.Key, x.Value} {
+				if e != nil {
+					g.flow(x.X, g.target(e))
+				}
+			}
+		case *ast.SendStmt:
+			g.flow(x.Value, "sent on a channel")
+		case *ast.GoStmt:
+			for _, arg := range x.Call.Args {
+				g.flow(arg, "passed to a goroutine")
+			}
+		case *ast.CallExpr:
+			if isAllocation(x) {
+				g.site(x, nil)
+			}
+			g.call(x)
+		case *ast.UnaryExpr:
+			g.sources(x)
+		}
+		return true
+	})
+}
+
+// declaration records that the given variable is declared with the given
+// value, which may be a pointer to a new value that can be stored on the stack
+func (g *escapeGraph) declaration(id *ast.Ident, value ast.Expr) {
+	if isAllocation(value) {
+		g.site(value, nil).storage = id
+	}
+}
+
+// objectPos returns the position of the declaration of the given variable
+func objectPos(object *ast.Object) token.Pos {
+	switch d := object.Decl.(type) {
+	case *ast.AssignStmt:
+		for _, left := range d.Lhs {
+			if id, ok := left.(*ast.Ident); ok && id.Obj == object {
+				return id.Pos()
+			}
+		}
+	case *ast.ValueSpec:
+		for _, id := range d.Names {
+			if id.Obj == object {
+				return id.Pos()
+			}
+		}
+	case *ast.Field:
+		for _, id := range d.Names {
+			if id.Obj == object {
+				return id.Pos()
+			}
+		}
+	}
+	if n, ok := object.Decl.(ast.Node); ok {
+		return n.Pos()
+	}
+	return token.NoPos
+}
+
+// reach returns the reason why the given allocation or variable escapes,
+// or an empty string, and the variables that its address may be stored in
+func (g *escapeGraph) reach(from any) (string, []*ast.Object) {
+	visited := map[any]bool{from: true}
+	queue := []any{from}
+	var reached []*ast.Object
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, to := range g.flows[node] {
+			if reason, ok := to.(string); ok {
+				if _, ok := node.(*ast.FuncLit); ok {
+					return "captured by a closure that is " + reason, reached
+				}
+				return reason, reached
+			}
+			if visited[to] {
+				continue
+			}
+			visited[to] = true
+			if _, ok := to.(*ast.FuncLit); ok {
+				queue = append(queue, to)
+				continue
+			}
+			object := to.(*ast.Object)
+			if a := g.addressed[object]; a != nil && a != from {
+				// The variable may be read through a pointer
+				return "stored in " + object.Name + ", which has its address taken", reached
+			}
+			reached = append(reached, object)
+			queue = append(queue, object)
+		}
+	}
+	return "", reached
+}
+
+// Escapes finds the values that are allocated in the functions in the
+// given file that must be placed on the heap, and the values that can be
+// placed on the stack instead
+func Escapes(file *ast.File, fset *token.FileSet, text func(ast.Node) string, bodies map[*ast.FuncDecl]*function) {
+	leaks := map[*ast.Object][]bool{}
+	receivers := map[string]bool{}
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok && d.Recv == nil && d.Name.Obj != nil {
+			leaks[d.Name.Obj] = make([]bool, max(d.Type.Params.NumFields(), 1))
+		}
+	}
+	// The parameters that may outlive a call are found by repeating the
+	// analysis until no more parameters are found
+	for {
+		g := &escapeGraph{
+			file:      file,
+			fset:      fset,
+			text:      text,
+			leaks:     leaks,
+			receivers: receivers,
+			flows:     map[any][]any{},
+			sites:     map[ast.Node]*allocation{},
+			addressed: map[*ast.Object]*allocation{},
+			results:   map[*ast.Object]bool{},
+			captured:  map[*ast.Object]bool{},
+			fixed:     map[*ast.Object]bool{},
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.FuncDecl, *ast.FuncLit, *ast.BlockStmt, *ast.IfStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.CaseClause, *ast.CommClause, *ast.SelectStmt:
+				g.scopes = append(g.scopes, n)
+			case *ast.ForStmt:
+				g.scopes = append(g.scopes, n)
+				if init, ok := x.Init.(*ast.AssignStmt); ok && init.Tok == token.DEFINE {
+					for _, left := range init.Lhs {
+						if id, ok := left.(*ast.Ident); ok && id.Obj != nil {
+							g.fixed[id.Obj] = true
+						}
+					}
+				}
+			case *ast.RangeStmt:
+				g.scopes = append(g.scopes, n)
+				for _, e := range []ast.Expr{x.Key, x.Value} {
+					if id, ok := e.(*ast.Ident); ok && x.Tok == token.DEFINE && id.Obj != nil {
+						g.fixed[id.Obj] = true
+					}
+				}
+			}
+			return true
+		})
+		var decls []*ast.FuncDecl
+		for _, decl := range file.Decls {
+			if d, ok := decl.(*ast.FuncDecl); ok && d.Body != nil {
+				decls = append(decls, d)
+				if d.Recv != nil {
+					for _, field := range d.Recv.List {
+						for _, id := range field.Names {
+							g.fixed[id.Obj] = true
+						}
+					}
+				}
+				if d.Type.Results != nil {
+					for _, field := range d.Type.Results.List {
+						for _, id := range field.Names {
+							g.results[id.Obj] = true
+						}
+					}
+				}
+			}
+		}
+		for _, d := range decls {
+			g.function(d.Body, bodies[d])
+		}
+		changed := false
+		for _, d := range decls {
+			if d.Recv != nil && len(d.Recv.List) == 1 && len(d.Recv.List[0].Names) == 1 {
+				key := strings.TrimPrefix(text(d.Recv.List[0].Type), "*") + "." + d.Name.Name
+				if reason, _ := g.reach(d.Recv.List[0].Names[0].Obj); reason != "" && !receivers[key] {
+					receivers[key] = true
+					changed = true
+				}
+			}
+			if leaks[d.Name.Obj] == nil || d.Type.Params == nil {
+				continue
+			}
+			i := 0
+			for _, field := range d.Type.Params.List {
+				for _, id := range field.Names {
+					if reason, _ := g.reach(id.Obj); reason != "" && !leaks[d.Name.Obj][i] {
+						leaks[d.Name.Obj][i] = true
+						changed = true
+					}
+					i++
+				}
+				if len(field.Names) == 0 {
+					i++
+				}
+			}
+		}
+		if !changed {
+			decided := g.decide()
+			if explainEscapes {
+				explain(decided)
+			}
+			return
+		}
+	}
+}
+
+// decide decides where each allocation is placed, and returns the allocations
+func (g *escapeGraph) decide() []*allocation {
+	var all []*allocation
+	for _, a := range g.addressed {
+		all = append(all, a)
+	}
+	for _, a := range g.sites {
+		if a != nil && a.object == nil {
+			all = append(all, a)
+			allocations = append(allocations, a)
+		}
+	}
+	for _, a := range all {
+		reason, reached := g.reach(a)
+		storage := a.object
+		if a.storage != nil {
+			storage = a.storage.Obj
+		}
+		if reason == "" && a.object == nil && len(reached) == 0 {
+			a.temporary = true
+			continue
+		}
+		if reason == "" && storage == nil {
+			reason = "assigned to " + reached[0].Name
+		}
+		if reason == "" {
+			storageScope := g.scope(objectPos(storage))
+			for _, object := range reached {
+				if !within(g.scope(objectPos(object)), storageScope) {
+					reason = "assigned to " + object.Name + ", which outlives it"
+					if a.object != nil && g.captured[a.object] {
+						reason = "captured by a closure that is " + reason
+					}
+					break
+				}
+			}
+		}
+		a.reason = reason
+		if a.object != nil && reason != "" {
+			line := a.pos.Line - 1
+			if _, ok := a.object.Decl.(*ast.Field); ok {
+				// The parameters are declared on the first line of the function
+				line = g.fset.Position(g.scope(objectPos(a.object)).Pos()).Line - 1
+			}
+			heapVariables[variable{a.object.Name, line}] = true
+		} else if a.storage != nil && reason == "" {
+			stackPointers[variable{a.storage.Name, g.fset.Position(a.storage.Pos()).Line - 1}] = true
+		}
+	}
+	sort.Slice(allocations, func(i, j int) bool {
+		return allocations[i].pos.Offset < allocations[j].pos.Offset
+	})
+	return all
+}
+
+// explain prints the escape analysis decisions to stderr, in the order of their positions
+func explain(decided []*allocation) {
+	sort.Slice(decided, func(i, j int) bool {
+		return decided[i].pos.Offset < decided[j].pos.Offset
+	})
+	for _, a := range decided {
+		pos := fmt.Sprintf("%s:%d:%d", sourceFilename, a.pos.Line, a.pos.Column)
+		switch {
+		case a.object != nil && a.reason != "":
+			fmt.Fprintf(os.Stderr, "%s: moved to heap: %s (%s)\n", pos, a.description, a.reason)
+		case a.reason != "":
+			fmt.Fprintf(os.Stderr, "%s: %s escapes to heap (%s)\n", pos, a.description, a.reason)
+		case a.temporary:
+			fmt.Fprintf(os.Stderr, "%s: %s does not escape (temporary)\n", pos, a.description)
+		default:
+			fmt.Fprintf(os.Stderr, "%s: %s does not escape\n", pos, a.description)
+		}
+	}
+}
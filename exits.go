@@ -0,0 +1,196 @@
+package main
+
+// Exits: panics, os.Exit, log.Fatal, log.Fatalf, log.Fatalln and returning from main, with the same exit statuses as in Go
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// The program may panic, so main and the package initialization handle panics
+var panics bool
+
+// Panics checks if the given Go program calls the builtin panic function, or
+// has expressions with runtime checks that may panic: indexing, slicing,
+// integer division and sending to or closing a channel.
+// A program that can not be parsed may panic.
+func Panics(source string) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), "", source, 0)
+	if err != nil {
+		return true
+	}
+	found := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.CallExpr:
+			// The builtin functions are not declared in the program
+			if fun, ok := ast.Unparen(e.Fun).(*ast.Ident); ok && (fun.Name == "panic" || fun.Name == "close") && fun.Obj == nil {
+				found = true
+			}
+		case *ast.IndexExpr, *ast.SliceExpr, *ast.SendStmt:
+			found = true
+		case *ast.BinaryExpr:
+			if e.Op == token.QUO || e.Op == token.REM {
+				found = true
+			}
+		case *ast.AssignStmt:
+			if e.Tok == token.QUO_ASSIGN || e.Tok == token.REM_ASSIGN {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// panicRuntime is the C++ code for panics. A panic unwinds the stack, so that
+// the deferred function calls are made, and a panic that is not recovered
+// exits with exit status 2.
+const panicRuntime = `// _panic_error is a Go panic, which unwinds the stack so that the deferred function calls are made
+class _panic_error {
+public:
+    std::string message;
+};
+
+// _panic starts a panic with the given value
+template <typename T> [[noreturn]] inline void _panic(T const& value)
+{
+    std::stringstream ss;
+    if constexpr (std::is_same<T, bool>::value) {
+        ss << std::boolalpha << value;
+    } else if constexpr (std::is_integral<T>::value) {
+        ss << +value;
+    } else if constexpr (requires { value.Error(); }) {
+        ss << value.Error();
+    } else {
+        ss << value;
+    }
+    throw _panic_error { ss.str() };
+}
+
+// _check_index panics if i is not an index of an array or a slice with the given length
+inline void _check_index(std::int64_t i, std::size_t length)
+{
+    if (i < 0) {
+        throw _panic_error { "runtime error: index out of range [" + std::to_string(i) + "]" };
+    }
+    if (static_cast<std::size_t>(i) >= length) {
+        throw _panic_error { "runtime error: index out of range [" + std::to_string(i) + "] with length " + std::to_string(length) };
+    }
+}
+
+// _divisor returns the divisor of an integer division, or panics if it is zero
+template <typename T> inline auto _divisor(T y) -> T
+{
+    if constexpr (std::is_integral<T>::value) {
+        if (y == 0) {
+            throw _panic_error { "runtime error: integer divide by zero" };
+        }
+    }
+    return y;
+}
+
+// _panic_exit outputs the value of a panic that is not recovered, and exits with exit status 2
+[[noreturn]] inline void _panic_exit(_panic_error const& e)
+{
+    std::cout.flush();
+    std::cerr << "panic: " << e.message << std::endl;
+    std::exit(2);
+}`
+
+// logFatal is the C++ code for log.Fatal, log.Fatalf and log.Fatalln, which
+// output the values like fmt.Print, fmt.Printf and fmt.Println, after the
+// date and the time, and exit with exit status 1 without making the deferred
+// function calls
+const logFatal = `// _log_exit outputs a message to stderr after the date and the time, with a newline at
+// the end if there is none, and exits with exit status 1
+[[noreturn]] inline void _log_exit(std::string const& message)
+{
+    std::cout.flush();
+    char timestamp[32];
+    auto now = std::time(nullptr);
+    std::strftime(timestamp, sizeof(timestamp), "%Y/%m/%d %H:%M:%S ", std::localtime(&now));
+    std::cerr << timestamp << message;
+    if (message.empty() || message.back() != '\n') {
+        std::cerr << std::endl;
+    }
+    std::exit(1);
+}
+
+// _log_fatal outputs the given values to stderr, like log.Fatal, and exits with exit status 1
+template <typename... T> [[noreturn]] inline void _log_fatal(T const&... values)
+{
+    std::stringstream ss;
+    ss << std::boolalpha;
+    // Spaces are added between the values when neither is a string
+    bool previousString = true;
+    ([&] {
+        constexpr bool isString = std::is_convertible<T, std::string>::value;
+        if (!previousString && !isString) {
+            ss << " ";
+        }
+        ss << values;
+        previousString = isString;
+    }(), ...);
+    _log_exit(ss.str());
+}
+
+// _log_fatalln outputs the given values to stderr with spaces between them, like
+// log.Fatalln, and exits with exit status 1
+template <typename... T> [[noreturn]] inline void _log_fatalln(T const&... values)
+{
+    std::stringstream ss;
+    ss << std::boolalpha;
+    bool first = true;
+    ([&] {
+        if (!first) {
+            ss << " ";
+        }
+        ss << values;
+        first = false;
+    }(), ...);
+    _log_exit(ss.str());
+}
+
+// _log_fatalf outputs the given values formatted with printf to stderr, like
+// log.Fatalf, and exits with exit status 1
+template <typename... T> [[noreturn]] inline void _log_fatalf(std::string const& format, T const&... values)
+{
+    // Strings are given to snprintf as C strings
+    auto arg = [](auto const& x) {
+        if constexpr (std::is_same<std::remove_cvref_t<decltype(x)>, std::string>::value) {
+            return x.c_str();
+        } else {
+            return x;
+        }
+    };
+    auto size = std::snprintf(nullptr, 0, format.c_str(), arg(values)...);
+    std::string message(size, '\0');
+    std::snprintf(message.data(), size + 1, format.c_str(), arg(values)...);
+    _log_exit(message);
+}`
+
+// MainStart returns the C++ function signature of main, with the start of
+// the block that handles the panics, if the program may panic
+func MainStart(signature string) string {
+	if !panics {
+		return signature
+	}
+	// The deferred function calls are made before the panic is handled
+	first, rest, _ := strings.Cut(signature, "\n")
+	if rest != "" {
+		return first + "\ntry {\n" + rest
+	}
+	return first + "\ntry {"
+}
+
+// MainEnd returns the C++ code for the end of main, which exits with exit
+// status 0 when the end of main is reached
+func MainEnd() string {
+	if !panics {
+		return "return 0;\n}"
+	}
+	return "} catch (_panic_error const& e) {\n_panic_exit(e);\n}\nreturn 0;\n}"
+}
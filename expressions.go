@@ -0,0 +1,276 @@
+package main
+
+// Transformation of Go expressions that needs the syntax tree of a line of code
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// edit is a replacement of the Go code between two positions in a line
+type edit struct {
+	pos, end int
+	text     string
+}
+
+// lineWrappers are used for parsing a line of Go code that is not a complete
+// statement or declaration on its own. The line is placed where %s is.
+var lineWrappers = []string{
+	"package p\nfunc _() {\n%s\n}",
+	"package p\nfunc _() {\n%s\n}}",
+	"package p\nfunc _() {\nswitch {\n%s\n}}",
+	"package p\nfunc _() {\nif true {\n%s\n}}",
+	"package p\n%s\n",
+	"package p\n%s\n}",
+}
+
+// parseLine parses a line of Go code. Returns the syntax tree, the file set
+// and the position of the start of the line in the parsed code.
+func parseLine(line string) (*ast.File, *token.FileSet, int, bool) {
+	for _, wrapper := range lineWrappers {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "", fmt.Sprintf(wrapper, line), 0)
+		if err == nil {
+			return file, fset, strings.Index(wrapper, "%s"), true
+		}
+	}
+	return nil, nil, 0, false
+}
+
+// lineEditor collects the edits of a line of Go code
+type lineEditor struct {
+	line   string
+	offset func(token.Pos) int // the position in the line of a position in the syntax tree
+	edits  []edit
+	sites  map[ast.Node]*allocation // the escape analysis decisions for &T{...} and new(T)
+}
+
+// inLine checks if the given node is within the line
+func (e *lineEditor) inLine(n ast.Node) bool {
+	return e.offset(n.Pos()) >= 0 && e.offset(n.End()) <= len(e.line)
+}
+
+// text returns the Go code of the given node
+func (e *lineEditor) text(n ast.Node) string {
+	return e.line[e.offset(n.Pos()):e.offset(n.End())]
+}
+
+// render returns the code between the given positions in the line, with the
+// edits that are within these positions applied. These edits are then removed.
+func (e *lineEditor) render(from, to int) string {
+	var inside, outside []edit
+	for _, ed := range e.edits {
+		if ed.pos >= from && ed.end <= to {
+			inside = append(inside, ed)
+		} else {
+			outside = append(outside, ed)
+		}
+	}
+	e.edits = outside
+	// Apply the edits from the end, so that the positions stay valid. A
+	// replacement is applied before an insertion at the same position, so
+	// that the inserted code comes before the replaced code.
+	sort.SliceStable(inside, func(i, j int) bool {
+		if inside[i].pos != inside[j].pos {
+			return inside[i].pos > inside[j].pos
+		}
+		return inside[i].end > inside[j].end
+	})
+	code := e.line[from:to]
+	for _, ed := range inside {
+		code = code[:ed.pos-from] + ed.text + code[ed.end-from:]
+	}
+	return code
+}
+
+// renderNode returns the code of the given node, with the edits applied
+func (e *lineEditor) renderNode(n ast.Node) string {
+	return e.render(e.offset(n.Pos()), e.offset(n.End()))
+}
+
+// replace replaces the code of the given node
+func (e *lineEditor) replace(n ast.Node, text string) {
+	e.edits = append(e.edits, edit{e.offset(n.Pos()), e.offset(n.End()), text})
+}
+
+// replaceAll replaces the code of the given node, and the edits within it.
+// The insertions right before and after the node are kept.
+func (e *lineEditor) replaceAll(n ast.Node, text string) {
+	from, to := e.offset(n.Pos()), e.offset(n.End())
+	var kept []edit
+	for _, ed := range e.edits {
+		if ed.pos < from || ed.end > to || (ed.pos == ed.end && (ed.pos == from || ed.pos == to)) {
+			kept = append(kept, ed)
+		}
+	}
+	e.edits = append(kept, edit{from, to, text})
+}
+
+// allocations returns the escape analysis decisions for the &T{...} and
+// new(T) expressions in the line, which are found by their order in the
+// lines that the line consists of. Returns nil if the expressions differ.
+func (e *lineEditor) allocations(root ast.Node) map[ast.Node]*allocation {
+	var nodes []ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if isAllocation(n) && e.inLine(n) {
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	var decided []*allocation
+	for _, a := range allocations {
+		if a.pos.Line-1 >= currentLine && a.pos.Line-1 <= lastLine {
+			decided = append(decided, a)
+		}
+	}
+	if len(nodes) == 0 || len(nodes) != len(decided) {
+		return nil
+	}
+	sites := map[ast.Node]*allocation{}
+	for i, n := range nodes {
+		if allocationDescription(n, e.text) != decided[i].description {
+			return nil
+		}
+		sites[n] = decided[i]
+	}
+	return sites
+}
+
+// Expressions transforms the expressions in a line of Go code that differ
+// in more than the names from the C++ expressions: some of the operators,
+// the arithmetic on integers that are smaller than 64 bits, the composite literals, the slice expressions, the map lookups that also
+// give if the key is in the map, the use of pointers, the method values, the
+// constants that are too large for any type and the untyped float constants
+// where an integer is needed.
+func Expressions(line string) string {
+	if !strings.ContainsAny(line, "&|^<>{.*([/%+-") && !mentionsLargeConstant(line) {
+		return line
+	}
+	file, fset, start, ok := parseLine(line)
+	if !ok {
+		return line
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset - start
+	}
+	e := &lineEditor{line: line, offset: offset}
+	e.sites = e.allocations(file)
+	e.edits = append(operatorEdits(file, offset), pointerEdits(line, file, offset, e.sites)...)
+	e.edits = append(e.edits, channelEdits(line, file, offset)...)
+	e.edits = append(e.edits, sliceEdits(file, offset)...)
+	e.edits = append(e.edits, mapEdits(file, offset)...)
+	e.untypedOperands(file)
+	e.integerConstants(file)
+	e.foldConstants(file)
+	e.methodValues(file)
+	e.compositeLiterals(file)
+	for _, ed := range e.edits {
+		if ed.pos < 0 || ed.end > len(line) {
+			// Not a part of the line
+			return line
+		}
+	}
+	return e.render(0, len(line))
+}
+
+// sliceEdits returns the edits that transform the slice expressions in a
+// line of Go code, like xs[1:] to _slice_expr(xs, 1) and xs[:2] to
+// _slice_expr(xs, 0, 2). The bounds that are left out at the end are given
+// by _slice_expr.
+func sliceEdits(file *ast.File, offset func(token.Pos) int) []edit {
+	var edits []edit
+	ast.Inspect(file, func(n ast.Node) bool {
+		x, ok := n.(*ast.SliceExpr)
+		if !ok {
+			return true
+		}
+		edits = append(edits, edit{offset(x.Pos()), offset(x.Pos()), "_slice_expr("})
+		// The code between the bounds is replaced by commas
+		from, separator := offset(x.X.End()), ", "
+		for i, bound := range []ast.Expr{x.Low, x.High, x.Max} {
+			if bound == nil {
+				if i == 0 {
+					separator += "0, "
+				}
+				continue
+			}
+			edits = append(edits, edit{from, offset(bound.Pos()), separator})
+			from, separator = offset(bound.End()), ", "
+		}
+		edits = append(edits, edit{from, offset(x.Rbrack) + len("]"), strings.TrimSuffix(separator, ", ") + ")"})
+		return true
+	})
+	return edits
+}
+
+// commaOkValues returns the expressions that are assigned to two variables,
+// like <-ch in v, ok := <-ch and m[k] in v, ok := m[k]
+func commaOkValues(file *ast.File) map[ast.Expr]bool {
+	commaOk := map[ast.Expr]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.AssignStmt:
+			if len(x.Lhs) == 2 && len(x.Rhs) == 1 {
+				commaOk[ast.Unparen(x.Rhs[0])] = true
+			}
+		case *ast.ValueSpec:
+			if len(x.Names) == 2 && len(x.Values) == 1 {
+				commaOk[ast.Unparen(x.Values[0])] = true
+			}
+		}
+		return true
+	})
+	return commaOk
+}
+
+// mapEdits returns the edits that transform the map lookups that also give
+// if the key is in the map, like m[k] in v, ok := m[k] to _map_lookup(m, k)
+func mapEdits(file *ast.File, offset func(token.Pos) int) []edit {
+	var edits []edit
+	commaOk := commaOkValues(file)
+	ast.Inspect(file, func(n ast.Node) bool {
+		x, ok := n.(*ast.IndexExpr)
+		if !ok || !commaOk[x] {
+			return true
+		}
+		edits = append(edits,
+			edit{offset(x.Pos()), offset(x.Pos()), "_map_lookup("},
+			edit{offset(x.X.End()), offset(x.Index.Pos()), ", "},
+			edit{offset(x.Index.End()), offset(x.End()), ")"})
+		return true
+	})
+	return edits
+}
+
+// joinLines joins lines of Go code into one line, with semicolons where
+// the Go compiler would insert them at the ends of the lines
+func joinLines(lines []string) string {
+	var joined []string
+	for _, line := range lines {
+		code := strings.TrimSpace(line)
+		if code == "" {
+			continue
+		}
+		var s scanner.Scanner
+		fset := token.NewFileSet()
+		s.Init(fset.AddFile("", fset.Base(), len(code)), []byte(code), func(token.Position, string) {}, 0)
+		last, lit := token.ILLEGAL, ""
+		for {
+			_, tok, l := s.Scan()
+			if tok == token.EOF {
+				break
+			}
+			last, lit = tok, l
+		}
+		if last == token.SEMICOLON && lit == "\n" {
+			code += ";"
+		}
+		joined = append(joined, code)
+	}
+	return strings.Join(joined, " ")
+}
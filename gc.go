@@ -0,0 +1,249 @@
+package main
+
+// The memory management of the generated code
+
+// garbageCollector is true if the variables on the heap are garbage collected.
+// Otherwise they are never freed.
+var garbageCollector = true
+
+// memStats is the C++ type for runtime.MemStats
+const memStats = `// _gc_mem_stats is runtime.MemStats
+struct _gc_mem_stats {
+    std::uint64_t Alloc;
+    std::uint64_t TotalAlloc;
+    std::uint64_t Mallocs;
+    std::uint64_t Frees;
+    std::uint64_t HeapAlloc;
+    std::uint64_t HeapObjects;
+    std::uint64_t NextGC;
+    std::uint32_t NumGC;
+};
+`
+
+// gcRuntime is the memory management when garbageCollector is true
+const gcRuntime = memStats + `
+// The garbage collector is a mark-and-sweep collector, with a conservative scan
+// of the stack, the registers and the global variables. All memory that is
+// allocated with operator new is tracked and scanned, so that the pointers in
+// slices, maps and closures are found, but only the variables that are
+// created with _gc_new are collected.
+extern "C" char __data_start[], _end[];
+extern "C" void* __libc_stack_end;
+
+// _gc_block is the header of an allocated block of memory
+struct alignas(16) _gc_block {
+    _gc_block* prev;
+    _gc_block* next;
+    std::size_t size;
+    void (*destroy)(void*); // the destructor of a collected variable, or nullptr
+    bool marked;
+};
+
+struct _gc_heap {
+    _gc_block* first;
+    std::size_t objects;
+    std::size_t bytes;
+    std::size_t allocated; // the bytes allocated with _gc_new since the last collection
+    std::size_t next_collection;
+    std::uint64_t total_bytes;
+    std::uint64_t mallocs;
+    std::uint64_t frees;
+    std::uint32_t collections;
+};
+
+// _gc is constant initialized, since memory may be allocated before main is called
+inline _gc_heap _gc { nullptr, 0, 0, 0, 4 << 20, 0, 0, 0, 0 };
+
+inline auto _gc_allocate(std::size_t size, void (*destroy)(void*)) -> void*
+{
+    auto b = static_cast<_gc_block*>(std::malloc(sizeof(_gc_block) + size));
+    if (b == nullptr) {
+        std::cerr << "fatal error: runtime: out of memory" << std::endl;
+        std::exit(2);
+    }
+    b->prev = nullptr;
+    b->next = _gc.first;
+    if (_gc.first != nullptr) {
+        _gc.first->prev = b;
+    }
+    _gc.first = b;
+    b->size = size;
+    b->destroy = destroy;
+    b->marked = false;
+    _gc.objects++;
+    _gc.bytes += size;
+    _gc.total_bytes += size;
+    _gc.mallocs++;
+    return b + 1;
+}
+
+inline void _gc_free(void* p)
+{
+    if (p == nullptr) {
+        return;
+    }
+    auto b = static_cast<_gc_block*>(p) - 1;
+    if (b->prev != nullptr) {
+        b->prev->next = b->next;
+    } else {
+        _gc.first = b->next;
+    }
+    if (b->next != nullptr) {
+        b->next->prev = b->prev;
+    }
+    _gc.objects--;
+    _gc.bytes -= b->size;
+    _gc.frees++;
+    std::free(b);
+}
+
+void* operator new(std::size_t size) { return _gc_allocate(size, nullptr); }
+void* operator new[](std::size_t size) { return _gc_allocate(size, nullptr); }
+void operator delete(void* p) noexcept { _gc_free(p); }
+void operator delete[](void* p) noexcept { _gc_free(p); }
+void operator delete(void* p, std::size_t) noexcept { _gc_free(p); }
+void operator delete[](void* p, std::size_t) noexcept { _gc_free(p); }
+
+// _gc_marker marks the blocks that can be reached from the scanned memory
+struct _gc_marker {
+    _gc_block** blocks; // sorted by address
+    std::size_t count;
+    _gc_block** stack; // the marked blocks that are not yet scanned
+    std::size_t depth;
+    std::size_t capacity;
+
+    // find returns the block that contains the given address, or nullptr
+    auto find(std::uintptr_t p) const -> _gc_block*
+    {
+        auto it = std::upper_bound(blocks, blocks + count, p, [](std::uintptr_t p, _gc_block* b) { return p < reinterpret_cast<std::uintptr_t>(b + 1); });
+        if (it == blocks) {
+            return nullptr;
+        }
+        auto b = *(it - 1);
+        auto start = reinterpret_cast<std::uintptr_t>(b + 1);
+        return p < start + std::max<std::size_t>(b->size, 1) ? b : nullptr;
+    }
+
+    // scan marks the blocks that the words in the given memory may point to
+    void scan(void const* from, void const* to)
+    {
+        auto start = (reinterpret_cast<std::uintptr_t>(from) + sizeof(void*) - 1) & ~(sizeof(void*) - 1);
+        auto end = reinterpret_cast<std::uintptr_t>(to);
+        for (auto p = start; p + sizeof(void*) <= end; p += sizeof(void*)) {
+            auto b = find(*reinterpret_cast<std::uintptr_t const*>(p));
+            if (b == nullptr || b->marked) {
+                continue;
+            }
+            b->marked = true;
+            if (depth == capacity) {
+                capacity = capacity * 2 + 64;
+                stack = static_cast<_gc_block**>(std::realloc(stack, capacity * sizeof(_gc_block*)));
+            }
+            stack[depth++] = b;
+        }
+    }
+
+    // drain scans the marked blocks, until all the reachable blocks are marked
+    void drain()
+    {
+        while (depth > 0) {
+            auto b = stack[--depth];
+            scan(b + 1, reinterpret_cast<char const*>(b + 1) + b->size);
+        }
+    }
+};
+
+__attribute__((noinline, no_sanitize_address)) inline void _gc_mark_and_sweep()
+{
+    _gc_marker m { static_cast<_gc_block**>(std::malloc((_gc.objects + 1) * sizeof(_gc_block*))), 0, nullptr, 0, 0 };
+    for (auto b = _gc.first; b != nullptr; b = b->next) {
+        m.blocks[m.count++] = b;
+    }
+    std::sort(m.blocks, m.blocks + m.count);
+    // The roots are the stack below this function, the registers that are saved on it and the global variables
+    m.scan(__builtin_frame_address(0), __libc_stack_end);
+    m.scan(__data_start, &_gc);
+    m.scan(&_gc + 1, _end);
+    m.drain();
+    // The unreachable variables are destroyed after all of them are found,
+    // since the destructors may free other blocks
+    std::size_t garbage = 0;
+    for (std::size_t i = 0; i < m.count; i++) {
+        auto b = m.blocks[i];
+        if (!b->marked && b->destroy != nullptr) {
+            m.blocks[garbage++] = b;
+        }
+        b->marked = false;
+    }
+    for (std::size_t i = 0; i < garbage; i++) {
+        m.blocks[i]->destroy(m.blocks[i] + 1);
+        _gc_free(m.blocks[i] + 1);
+    }
+    std::free(m.blocks);
+    std::free(m.stack);
+}
+
+// _gc_collect runs a garbage collection, like runtime.GC
+__attribute__((noinline)) inline void _gc_collect()
+{
+    // Save the registers on the stack, so that the pointers in them are found
+    std::jmp_buf registers;
+    setjmp(registers);
+    _gc_mark_and_sweep();
+    _gc.collections++;
+    _gc.allocated = 0;
+    // The next collection is when the heap has doubled, as with GOGC=100
+    _gc.next_collection = std::max<std::size_t>(_gc.bytes, 4 << 20);
+}
+
+// _gc_new returns a pointer to a new variable with the given value, that is
+// collected when it can no longer be reached
+template <typename T> inline auto _gc_new(T value) -> T*
+{
+    static_assert(alignof(T) <= alignof(_gc_block));
+    if (_gc.allocated >= _gc.next_collection) {
+        _gc_collect();
+    }
+    _gc.allocated += sizeof(T);
+    auto p = _gc_allocate(sizeof(T), [](void* p) { static_cast<T*>(p)->~T(); });
+    return new (p) T(std::move(value));
+}
+
+// _gc_read_mem_stats is runtime.ReadMemStats
+inline void _gc_read_mem_stats(_gc_mem_stats* m)
+{
+    m->Alloc = m->HeapAlloc = _gc.bytes;
+    m->TotalAlloc = _gc.total_bytes;
+    m->Mallocs = _gc.mallocs;
+    m->Frees = _gc.frees;
+    m->HeapObjects = _gc.objects;
+    m->NextGC = _gc.bytes - _gc.allocated + _gc.next_collection;
+    m->NumGC = _gc.collections;
+}`
+
+// noGCRuntime is the memory management when garbageCollector is false
+const noGCRuntime = memStats + `
+// The garbage collector is disabled, so the variables on the heap are never freed
+inline std::uint64_t _gc_mallocs = 0;
+inline std::uint64_t _gc_bytes = 0;
+
+// _gc_collect does nothing, since there is no garbage collector
+inline void _gc_collect() { }
+
+// _gc_new returns a pointer to a new variable with the given value
+template <typename T> inline auto _gc_new(T value) -> T*
+{
+    _gc_mallocs++;
+    _gc_bytes += sizeof(T);
+    return new T(std::move(value));
+}
+
+// _gc_read_mem_stats is runtime.ReadMemStats
+inline void _gc_read_mem_stats(_gc_mem_stats* m)
+{
+    m->Alloc = m->HeapAlloc = m->TotalAlloc = _gc_bytes;
+    m->Mallocs = m->HeapObjects = _gc_mallocs;
+    m->Frees = 0;
+    m->NextGC = 0;
+    m->NumGC = 0;
+}`
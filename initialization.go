@@ -0,0 +1,337 @@
+package main
+
+// Package initialization: the package level variables are initialized in
+// dependency order, and then the init functions are called, before main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+)
+
+var (
+	// The package level variables that are initialized after all the
+	// declarations, instead of where they are declared, in the order of the
+	// initialization
+	initializationOrder []string
+
+	// The C++ assignments that initialize the variables in initializationOrder, by name
+	packageInitializers = map[string]string{}
+
+	// The number of init functions so far
+	initFunctions int
+)
+
+// initGraph is the references between the package level variables and functions
+type initGraph struct {
+	fset       *token.FileSet
+	references map[*ast.Object][]*ast.Object // the variables and functions that the initializer or the body refers to
+	positions  map[*ast.Object]token.Pos
+	methods    map[string][]*ast.Object // the methods, by name
+}
+
+// refers returns the package level variables and functions that the given
+// node refers to, in the order of the references
+func (g *initGraph) refers(n ast.Node) []*ast.Object {
+	var result []*ast.Object
+	seen := map[*ast.Object]bool{}
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.Ident:
+			if _, ok := g.positions[x.Obj]; x.Obj != nil && ok && !seen[x.Obj] {
+				seen[x.Obj] = true
+				result = append(result, x.Obj)
+			}
+		case *ast.SelectorExpr:
+			// The type of x in x.m is not known, so all the methods named m may be referred to
+			for _, method := range g.methods[x.Sel.Name] {
+				if !seen[method] {
+					seen[method] = true
+					result = append(result, method)
+				}
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// reach returns the variables and the functions that are used when the
+// given variable is initialized, which are the variables it refers to and
+// everything the functions it calls refer to
+func (g *initGraph) reach(object *ast.Object) []*ast.Object {
+	var result []*ast.Object
+	visited := map[*ast.Object]bool{object: true}
+	queue := append([]*ast.Object{}, g.references[object]...)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if visited[next] {
+			continue
+		}
+		visited[next] = true
+		result = append(result, next)
+		if next.Kind == ast.Fun {
+			queue = append(queue, g.references[next]...)
+		}
+	}
+	return result
+}
+
+// cycle returns the references from the given variable back to itself, if any
+func (g *initGraph) cycle(object *ast.Object) []*ast.Object {
+	visited := map[*ast.Object]bool{}
+	var path []*ast.Object
+	var search func(*ast.Object) bool
+	search = func(from *ast.Object) bool {
+		for _, to := range g.references[from] {
+			if to == object {
+				path = append(path, from)
+				return true
+			}
+			if visited[to] {
+				continue
+			}
+			visited[to] = true
+			if search(to) {
+				path = append(path, from)
+				return true
+			}
+		}
+		return false
+	}
+	if !search(object) {
+		return nil
+	}
+	// The path is found from the end
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// reportCycle outputs an initialization cycle, like the Go compiler, and exits
+func (g *initGraph) reportCycle(cycle []*ast.Object) {
+	position := func(object *ast.Object) string {
+		pos := g.fset.Position(g.positions[object])
+		return fmt.Sprintf("%s:%d:%d", sourceFilename, pos.Line, pos.Column)
+	}
+	if len(cycle) == 1 {
+		fmt.Fprintf(os.Stderr, "%s: initialization cycle: %s refers to itself\n", position(cycle[0]), cycle[0].Name)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "%s: initialization cycle for %s\n", position(cycle[0]), cycle[0].Name)
+	for i, object := range cycle {
+		next := cycle[(i+1)%len(cycle)]
+		fmt.Fprintf(os.Stderr, "\t%s: %s refers to %s\n", position(object), object.Name, next.Name)
+	}
+	os.Exit(1)
+}
+
+// Initialization finds the order that the package level variables in the
+// given lines of Go code are initialized in, and which of them must be
+// initialized after all the declarations. An initialization cycle is an error.
+func Initialization(lines []string) {
+	initializationOrder = nil
+	packageInitializers = map[string]string{}
+	initFunctions = 0
+	source := strings.Join(lines, "\n")
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, 0)
+	if err != nil {
+		return
+	}
+	g := &initGraph{
+		fset:       fset,
+		references: map[*ast.Object][]*ast.Object{},
+		positions:  map[*ast.Object]token.Pos{},
+		methods:    map[string][]*ast.Object{},
+	}
+	// The methods are not declared in the package scope, so they are given objects of their own
+	methods := map[*ast.FuncDecl]*ast.Object{}
+	// The variables that are initialized with a value, in the order of their declarations
+	var declared []*ast.Object
+	values := map[*ast.Object]ast.Expr{}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range d.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, id := range vs.Names {
+					if id.Obj == nil {
+						// A blank identifier
+						continue
+					}
+					g.positions[id.Obj] = id.Pos()
+					if len(vs.Values) == len(vs.Names) {
+						declared = append(declared, id.Obj)
+						values[id.Obj] = vs.Values[i]
+					} else if len(vs.Values) == 1 {
+						// The variables are given the results of a function call
+						declared = append(declared, id.Obj)
+						values[id.Obj] = vs.Values[0]
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			// The init functions can not be referred to
+			if d.Recv == nil && d.Name.Name != "init" && d.Name.Obj != nil {
+				g.positions[d.Name.Obj] = d.Name.Pos()
+			} else if d.Recv != nil && len(d.Recv.List) == 1 {
+				receiver := d.Recv.List[0].Type
+				if star, ok := receiver.(*ast.StarExpr); ok {
+					receiver = star.X
+				}
+				name := d.Name.Name
+				if id, ok := receiver.(*ast.Ident); ok {
+					name = id.Name + "." + name
+				}
+				method := &ast.Object{Kind: ast.Fun, Name: name, Decl: d}
+				g.positions[method] = d.Name.Pos()
+				g.methods[d.Name.Name] = append(g.methods[d.Name.Name], method)
+				methods[d] = method
+			}
+		}
+	}
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok && d.Body != nil {
+			if method, ok := methods[d]; ok {
+				g.references[method] = g.refers(d.Body)
+			} else if _, ok := g.positions[d.Name.Obj]; ok && d.Recv == nil {
+				g.references[d.Name.Obj] = g.refers(d.Body)
+			}
+		}
+	}
+	for _, object := range declared {
+		g.references[object] = g.refers(values[object])
+	}
+	for _, object := range declared {
+		if cycle := g.cycle(object); cycle != nil {
+			g.reportCycle(cycle)
+		}
+	}
+	// The next variable to be initialized is the first one in the order of
+	// the declarations that does not depend on variables that are not yet initialized
+	initialized := map[*ast.Object]bool{}
+	var order []*ast.Object
+	for len(order) < len(declared) {
+		for _, object := range declared {
+			if initialized[object] {
+				continue
+			}
+			ready := true
+			for _, dependency := range g.reach(object) {
+				if _, ok := values[dependency]; ok && !initialized[dependency] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				initialized[object] = true
+				order = append(order, object)
+				break
+			}
+		}
+	}
+	// The variables are initialized where they are declared, until one of
+	// them is initialized out of order or uses a later declaration
+	for i, object := range order {
+		inPlace := object == declared[i]
+		for _, dependency := range g.reach(object) {
+			// The methods are declared in the classes, before the variables
+			if method, _ := dependency.Decl.(*ast.FuncDecl); methods[method] == nil && g.positions[dependency] > g.positions[object] {
+				inPlace = false
+			}
+		}
+		if !inPlace {
+			for _, object := range order[i:] {
+				// The type must be known, for declaring the variable before it is initialized
+				if globalVariables[object.Name] == "" {
+					pos := fset.Position(g.positions[object])
+					fmt.Fprintf(os.Stderr, "%s:%d:%d: the type of %s must be given, since it is initialized after a variable that is declared later\n", sourceFilename, pos.Line, pos.Column, object.Name)
+					os.Exit(1)
+				}
+				initializationOrder = append(initializationOrder, object.Name)
+			}
+			break
+		}
+	}
+}
+
+// PackageVariable transforms the C++ declaration of a package level variable
+// with a value to the declaration of a zero valued variable, if the variable
+// is initialized after all the declarations
+func PackageVariable(declaration, name string) string {
+	if !has(initializationOrder, name) {
+		return declaration
+	}
+	_, value, _ := strings.Cut(declaration, " = ")
+	packageInitializers[name] = name + " = " + strings.TrimSuffix(value, ";") + ";"
+	return TypeReplace(globalVariables[name]) + " " + name + " {};"
+}
+
+// PackageTuple transforms the C++ declaration of package level variables that
+// are given the results of a function call, like var a, b = pair(). If the
+// variables are initialized after all the declarations, they are declared
+// as zero valued variables.
+func PackageTuple(names []string, value string) string {
+	first := names[0]
+	if first == "_" {
+		first = names[1]
+	}
+	if !has(initializationOrder, first) {
+		output, _ := TupleAssignment(strings.Join(names, ", "), value, true, nil)
+		return output + ";"
+	}
+	var declarations []string
+	for _, name := range names {
+		if name != "_" {
+			declarations = append(declarations, TypeReplace(globalVariables[name])+" "+name+" {};")
+		}
+	}
+	// The variables are initialized together, when the first one is
+	assignment, _ := TupleAssignment(strings.Join(names, ", "), value, false, nil)
+	packageInitializers[first] = assignment + ";"
+	return strings.Join(declarations, "\n")
+}
+
+// InitFunction gives an init function a unique name, since there may be
+// several of them, and returns the C++ function signature
+func InitFunction(signature string) string {
+	initFunctions++
+	return strings.Replace(signature, "auto init(", fmt.Sprintf("auto _init_%d(", initFunctions), 1)
+}
+
+// PackageInitialization returns the C++ code that initializes the package
+// level variables in initializationOrder and then calls the init functions,
+// before main is called. It is placed after all the declarations.
+func PackageInitialization() string {
+	if len(initializationOrder) == 0 && initFunctions == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("// The package is initialized before main is called\n")
+	sb.WriteString("static auto _package_initialized = [] {\n")
+	if panics {
+		sb.WriteString("try {\n")
+	}
+	for _, name := range initializationOrder {
+		if initializer, ok := packageInitializers[name]; ok {
+			sb.WriteString(initializer + "\n")
+		}
+	}
+	for i := 1; i <= initFunctions; i++ {
+		sb.WriteString(fmt.Sprintf("_init_%d();\n", i))
+	}
+	if panics {
+		sb.WriteString("} catch (_panic_error const& e) {\n_panic_exit(e);\n}\n")
+	}
+	sb.WriteString("return true;\n}();\n")
+	return sb.String()
+}
@@ -0,0 +1,261 @@
+package main
+
+// Translation of Go composite literals to C++ initializers
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// constantIndex returns the value of an index in an array or slice literal
+func constantIndex(source string) (int, bool) {
+	c, err := EvalConstant(source)
+	if err != nil {
+		return 0, false
+	}
+	i, exact := constant.Int64Val(constant.ToInt(c.value))
+	return int(i), exact
+}
+
+// compositeLiterals transforms the composite literals in a line of Go code.
+// The literals within a literal are transformed as a part of it, since their
+// types may be elided.
+func (e *lineEditor) compositeLiterals(root ast.Node) {
+	var parents []ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == nil {
+			parents = parents[:len(parents)-1]
+			return true
+		}
+		code := ""
+		switch x := n.(type) {
+		case *ast.UnaryExpr:
+			// &T{...} is a pointer to a new value
+			if lit, ok := x.X.(*ast.CompositeLit); ok && x.Op == token.AND && lit.Type != nil && e.inLine(x) {
+				code = allocate(e.sites[x], e.compositeLiteral(lit, e.text(lit.Type), true))
+			}
+		case *ast.CompositeLit:
+			if x.Type != nil && e.inLine(x) {
+				code = e.compositeLiteral(x, e.text(x.Type), true)
+			}
+		case *ast.StructType:
+			if spec, ok := parent(parents).(*ast.TypeSpec); ok && spec.Type == x {
+				// A named struct type has a class of its own
+				return false
+			}
+			if e.inLine(x) {
+				e.replace(x, AnonymousStruct(e.text(x)))
+				return false
+			}
+		}
+		if code == "" {
+			parents = append(parents, n)
+			return true
+		}
+		if strings.Contains(code[:strings.Index(code, "{")], ",") && !singleValue(parents) {
+			// The comma in a type like std::unordered_map<K, V> must not
+			// separate arguments or values
+			code = "(" + code + ")"
+		}
+		e.replace(n, code)
+		return false
+	})
+}
+
+// parent returns the innermost of the given nodes, or nil
+func parent(parents []ast.Node) ast.Node {
+	if len(parents) == 0 {
+		return nil
+	}
+	return parents[len(parents)-1]
+}
+
+// singleValue checks if the innermost of the given nodes is an assignment
+// or a declaration with a single value
+func singleValue(parents []ast.Node) bool {
+	if len(parents) == 0 {
+		return true
+	}
+	switch x := parents[len(parents)-1].(type) {
+	case *ast.AssignStmt:
+		return len(x.Rhs) == 1
+	case *ast.ValueSpec:
+		return len(x.Values) == 1
+	}
+	return false
+}
+
+// element returns the C++ code of an element of a composite literal, where
+// goType is the type of the element
+func (e *lineEditor) element(expr ast.Expr, goType string) string {
+	if lit, ok := expr.(*ast.CompositeLit); ok && lit.Type == nil {
+		if strings.HasPrefix(goType, "*") {
+			// The elided type is &T
+			return "_gc_new(" + e.compositeLiteral(lit, goType[1:], true) + ")"
+		}
+		return e.compositeLiteral(lit, goType, false)
+	}
+	if unary, ok := expr.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+		if lit, ok := unary.X.(*ast.CompositeLit); ok && lit.Type == nil {
+			return "_gc_new(" + e.compositeLiteral(lit, strings.TrimPrefix(goType, "*"), true) + ")"
+		}
+	}
+	e.compositeLiterals(expr)
+	return e.renderNode(expr)
+}
+
+// compositeLiteral returns the C++ code of a composite literal of the given
+// Go type. The C++ type is only written if it is explicit, since the type
+// of an element is given by the literal that it is in.
+func (e *lineEditor) compositeLiteral(lit *ast.CompositeLit, goType string, explicit bool) string {
+	if strings.HasPrefix(goType, "struct") {
+		goType = AnonymousStruct(goType)
+	}
+	cppType := ""
+	if explicit {
+		cppType = TypeReplace(goType)
+	}
+	var elements []string
+	fields, ok := structTypes[goType]
+	if !ok {
+		fields, ok = structTypes[underlyingType(goType)]
+	}
+	if ok {
+		// Keyed fields are given in the order of the struct fields, since
+		// designated initializers must be in that order
+		values := make([]string, len(fields))
+		keyed := false
+		for i, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				keyed = true
+				for j, field := range fields {
+					if field.name == e.text(kv.Key) {
+						values[j] = "." + field.name + " = " + e.element(kv.Value, field.goType)
+					}
+				}
+			} else if i < len(fields) {
+				values[i] = e.element(elt, fields[i].goType)
+			}
+		}
+		for _, value := range values {
+			if value != "" || !keyed {
+				elements = append(elements, value)
+			}
+		}
+		if !keyed && len(lit.Elts) == 0 {
+			elements = nil
+		}
+		return cppType + "{" + strings.Join(elements, ", ") + "}"
+	}
+	underlying := underlyingType(goType)
+	typeExpr, _ := parser.ParseExpr(underlying)
+	typeText := func(x ast.Expr) string {
+		return underlying[x.Pos()-1 : x.End()-1]
+	}
+	switch t := typeExpr.(type) {
+	case *ast.MapType:
+		keyType, valueType := typeText(t.Key), typeText(t.Value)
+		for _, elt := range lit.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			elements = append(elements, "{"+e.element(kv.Key, keyType)+", "+e.element(kv.Value, valueType)+"}")
+		}
+		return cppType + "{" + strings.Join(elements, ", ") + "}"
+	case *ast.ArrayType:
+		elementType := typeText(t.Elt)
+		// Elements may be given at an index, the other elements are zero
+		index := 0
+		for _, elt := range lit.Elts {
+			value := elt
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if i, ok := constantIndex(e.text(kv.Key)); ok {
+					index = i
+				}
+				e.renderNode(kv.Key)
+				value = kv.Value
+			}
+			for len(elements) <= index {
+				elements = append(elements, "{}")
+			}
+			elements[index] = e.element(value, elementType)
+			index++
+		}
+		if t.Len == nil {
+			return cppType + "{" + strings.Join(elements, ", ") + "}"
+		}
+		if _, ok := t.Len.(*ast.Ellipsis); ok && explicit {
+			// The length is the number of elements
+			cppType = "_array<" + TypeReplace(elementType) + ", " + strconv.Itoa(len(elements)) + ">"
+		}
+		// The elements are in a C array, in a std::array, in an _array
+		return cppType + "{{{" + strings.Join(elements, ", ") + "}}}"
+	}
+	// A struct type from another package, or an unknown type
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			elements = append(elements, "."+e.text(kv.Key)+" = "+e.element(kv.Value, ""))
+		} else {
+			elements = append(elements, e.element(elt, ""))
+		}
+	}
+	return cppType + "{" + strings.Join(elements, ", ") + "}"
+}
+
+// MultiLineLiteral joins the lines of a composite literal that is opened at
+// the end of the given line of Go code and closed on one of the following
+// lines. Returns the joined line and the number of following lines that
+// were joined, which is 0 if the line does not end with a composite literal.
+func MultiLineLiteral(line string, following []string) (string, int) {
+	joined := strings.TrimSpace(line)
+	if !strings.HasSuffix(joined, "{") {
+		return line, 0
+	}
+	lbrace := len(joined) - 1
+	depth := curlyBrackets(joined)
+	lines := []string{joined}
+	for i, next := range following {
+		code, _, _ := splitComment(next, false)
+		lines = append(lines, code)
+		depth += curlyBrackets(code)
+		if depth > 0 {
+			continue
+		}
+		joined = joinLines(lines)
+		file, fset, start, ok := parseLine(joined)
+		if !ok {
+			break
+		}
+		// The curly bracket may also be a part of the type, like in []struct {
+		found := false
+		ast.Inspect(file, func(n ast.Node) bool {
+			if lit, ok := n.(*ast.CompositeLit); ok && fset.Position(lit.Pos()).Offset-start <= lbrace && fset.Position(lit.Rbrace).Offset-start > lbrace {
+				found = true
+			}
+			return !found
+		})
+		if found {
+			return joined, i + 1
+		}
+		break
+	}
+	return line, 0
+}
+
+// curlyBrackets returns the number of curly brackets that are opened minus
+// the number of curly brackets that are closed in a line of Go code, not
+// counting the ones in string and character literals
+func curlyBrackets(code string) int {
+	depth := 0
+	for _, t := range tokens(code) {
+		switch t.tok {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+		}
+	}
+	return depth
+}
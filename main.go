@@ -8,10 +8,15 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -23,16 +28,22 @@ const (
 	keysSuffix    = "_k__"
 	switchPrefix  = "_s__"
 	labelPrefix   = "_l__"
+	rangePrefix   = "_r__"
+	deferStack    = "_d__"
 )
 
 var endings = []string{"{", ",", "}", ":"}
 
 var (
 	switchExpressionCounter = -1
-	firstCase               bool
-	switchLabel             string
 	labelCounter            int
-	iotaNumber              int // used for simple increases of iota constants
+	rangeCounter            int
+	iotaNumber              int    // the index of the current constant specification, in a const block
+	previousConstType       string // for repeating the previous type in a const block
+	previousConstValues     string // for repeating the previous expression list in a const block
+	// Since Go 1.22, each iteration of a for loop has its own loop variables.
+	// Before that, the loop variables were shared by all iterations.
+	perIterationLoopVariables = true
 )
 
 // between returns the string between two given strings, or the original string
@@ -118,13 +129,48 @@ func WholeProgramReplace(source string) (output string) {
 	return output
 }
 
+// formatFloat is used by _format_output for formatting floating point numbers
+// and complex numbers the same way as the %v verb in Go.
+const formatFloat = `template <typename T> std::string _format_float(T x)
+{
+    if (std::isnan(x)) {
+        return "NaN";
+    } else if (std::isinf(x)) {
+        return x > 0 ? "+Inf" : "-Inf";
+    }
+    // Use the shortest representation, and the exponent only if it is < -4 or >= 6
+    char buf[64];
+    auto result = std::to_chars(buf, buf + sizeof(buf), x, std::chars_format::scientific);
+    std::string s(buf, result.ptr);
+    auto exponent = std::stoi(s.substr(s.find('e') + 1));
+    if (exponent < -4 || exponent >= 6) {
+        return s;
+    }
+    result = std::to_chars(buf, buf + sizeof(buf), x, std::chars_format::fixed);
+    return std::string(buf, result.ptr);
+}
+
+template <typename T> struct _is_complex : std::false_type { };
+template <typename T> struct _is_complex<std::complex<T>> : std::true_type { };
+
+template <typename T> std::string _format_complex(T x)
+{
+    auto im = _format_float(x.imag());
+    if (im[0] != '-' && im[0] != '+') {
+        im = "+" + im;
+    }
+    return "(" + _format_float(x.real()) + im + "i)";
+}
+`
+
 func AddFunctions(source string, useFormatOutput, haveStructs bool) (output string) {
 	output = source
 	replacements := map[string]string{
 		"strings.Contains":  `inline auto stringsContains(std::string const& a, std::string const& b) -> bool { return a.find(b) != std::string::npos; }`,
 		"strings.HasPrefix": `inline auto stringsHasPrefix(std::string const& givenString, std::string const& prefix) -> auto { return 0 == givenString.find(prefix); }`,
 
-		"_format_output": `template<typename T>
+		"_format_output": formatFloat + `
+template<typename T>
 using _str_t = decltype( std::declval<T&>()._str() );
 
 template<typename T>
@@ -132,10 +178,30 @@ using _p_str_t = decltype( std::declval<T&>()->_str() );
 
 template <typename T> void _format_output(std::ostream& out, T x)
 {
+    if constexpr (std::is_pointer<T>::value) {
+        if (x == nullptr) {
+            out << "<nil>";
+            return;
+        }
+    }
     if constexpr (std::is_same<T, bool>::value) {
         out << std::boolalpha << x << std::noboolalpha;
     } else if constexpr (std::is_integral<T>::value) {
-        out << static_cast<int>(x);
+        out << +x; // promote char types to int
+    } else if constexpr (std::is_floating_point<T>::value) {
+        out << _format_float(x);
+    } else if constexpr (_is_complex<T>::value) {
+        out << _format_complex(x);
+    } else if constexpr (requires { x.cap(); }) {
+        // Slices and arrays are printed like [1 2 3]
+        out << "[";
+        for (std::size_t i = 0; i < x.size(); i++) {
+            if (i > 0) {
+                out << " ";
+            }
+            _format_output(out, x[i]);
+        }
+        out << "]";
     } else if constexpr (std::is_object<T>::value && !std::is_pointer<T>::value && std::experimental::is_detected_v<_str_t, T>) {
         out << x._str();
     } else if constexpr (std::is_object<T>::value && std::is_pointer<T>::value && std::experimental::is_detected_v<_p_str_t, T>) {
@@ -145,53 +211,514 @@ template <typename T> void _format_output(std::ostream& out, T x)
     }
 }`,
 		"strings.TrimSpace": `inline auto stringsTrimSpace(std::string const& s) -> std::string { std::string news {}; for (auto l : s) { if (l != ' ' && l != '\n' && l != '\t' && l != '\v' && l != '\f' && l != '\r') { news += l; } } return news; }`,
+		"_range_": `// _decode_rune decodes the UTF-8 encoded rune at the given position in a string,
+// and returns the rune and the length of the encoding
+inline auto _decode_rune(std::string_view s, std::size_t pos) -> std::pair<std::int32_t, std::size_t>
+{
+    unsigned char c = s[pos];
+    std::size_t n = c < 0x80 ? 1 : (c >> 5) == 0x6 ? 2 : (c >> 4) == 0xe ? 3 : (c >> 3) == 0x1e ? 4 : 0;
+    if (n == 0 || pos + n > s.size()) {
+        return { 0xfffd, 1 };
+    }
+    std::int32_t r = n == 1 ? c : c & (0x7f >> n);
+    for (std::size_t i = 1; i < n; i++) {
+        unsigned char cc = s[pos + i];
+        if ((cc >> 6) != 0x2) {
+            return { 0xfffd, 1 };
+        }
+        r = (r << 6) | (cc & 0x3f);
+    }
+    return { r, n };
+}
+
+// _range_indices returns what a for loop with one variable ranges over in Go:
+// the integers up to n, the keys of a map, the indices of a string or a list,
+// or the values that are received from a channel
+template <typename T> auto _range_indices(T const& x)
+{
+    if constexpr (std::is_integral<T>::value) {
+        return std::views::iota(T { 0 }, std::max(x, T { 0 }));
+    } else if constexpr (std::is_convertible<T, std::string_view>::value) {
+        std::string_view s(x);
+        std::vector<std::int64_t> indices;
+        for (std::size_t i = 0; i < s.size(); i += _decode_rune(s, i).second) {
+            indices.push_back(i);
+        }
+        return indices;
+    } else if constexpr (std::is_pointer<T>::value) {
+        return _range_indices(*x);
+    } else if constexpr (requires { x.receive_ok(); }) {
+        // The values that are received from a channel
+        return x;
+    } else if constexpr (requires { typename T::mapped_type; }) {
+        std::vector<typename T::key_type> keys;
+        for (auto const& [k, v] : x) {
+            keys.push_back(k);
+        }
+        return keys;
+    } else {
+        return std::views::iota(std::int64_t { 0 }, static_cast<std::int64_t>(std::size(x)));
+    }
+}
+
+// _range_pairs returns what a for loop with two variables ranges over in Go:
+// the keys and values of a map, the indices and runes of a string,
+// or the indices and elements of a list. The elements of a slice are read
+// in each iteration, so that changes made by the loop body are seen, but an
+// array is copied first, like in Go.
+template <typename T> auto _range_pairs(T const& x)
+{
+    if constexpr (std::is_convertible<T, std::string_view>::value) {
+        std::string_view s(x);
+        std::vector<std::pair<std::int64_t, std::int32_t>> pairs;
+        for (std::size_t i = 0; i < s.size();) {
+            auto [r, n] = _decode_rune(s, i);
+            pairs.emplace_back(i, r);
+            i += n;
+        }
+        return pairs;
+    } else if constexpr (std::is_pointer<T>::value) {
+        // The array that is pointed to is not copied
+        return std::views::iota(std::int64_t { 0 }, static_cast<std::int64_t>(std::size(*x))) | std::views::transform([x](std::int64_t i) {
+            return std::pair<std::int64_t, std::remove_cvref_t<decltype((*x)[i])>>(i, (*x)[i]);
+        });
+    } else if constexpr (requires { typename T::mapped_type; }) {
+        return std::vector<std::pair<typename T::key_type, typename T::mapped_type>>(x.begin(), x.end());
+    } else {
+        return std::views::iota(std::int64_t { 0 }, static_cast<std::int64_t>(std::size(x))) | std::views::transform([x](std::int64_t i) {
+            return std::pair<std::int64_t, std::remove_cvref_t<decltype(x[i])>>(i, x[i]);
+        });
+    }
+}`,
+		"_loop_variable(": `// _loop_variable places a loop variable on the heap, for function literals to capture
+template <typename T> inline auto _loop_variable(T value) { return std::make_shared<T>(value); }
+
+// _shared_loop_variable returns a loop variable on the heap that is shared by all iterations
+template <typename T> inline auto _shared_loop_variable(std::shared_ptr<void>& variable, T value) -> T&
+{
+    if (!variable) {
+        variable = std::make_shared<T>();
+    }
+    auto& v = *std::static_pointer_cast<T>(variable);
+    v = value;
+    return v;
+}`,
+		"_defer_stack": `// _defer_stack makes the deferred function calls in the reverse order, when a function returns
+class _defer_stack {
+public:
+    void push(std::function<void()> f) { calls.push_back(f); }
+    ~_defer_stack()
+    {
+        while (!calls.empty()) {
+            auto f = calls.back();
+            calls.pop_back();
+            f();
+        }
+    }
+
+private:
+    std::vector<std::function<void()>> calls;
+};`,
+		"_slice": `// _slice is a Go slice, a part of an array that may be shared with other slices
+template <typename T> class _slice {
+public:
+    _slice() = default;
+    _slice(std::nullptr_t) { }
+    _slice(std::initializer_list<T> elements)
+        : _slice(std::make_shared<std::vector<T>>(elements), elements.size())
+    {
+    }
+    _slice(std::shared_ptr<std::vector<T>> data, std::size_t length)
+        : owner(data)
+        , elements(data->data())
+        , length(length)
+        , capacity(data->size())
+    {
+    }
+    // A slice of an array does not own the elements, which are kept by the
+    // array variable, or by the garbage collector if it is on the heap
+    _slice(std::shared_ptr<void> owner, T* elements, std::size_t length, std::size_t capacity)
+        : owner(owner)
+        , elements(elements)
+        , length(length)
+        , capacity(capacity)
+    {
+    }
+    auto operator[](std::int64_t i) const -> T&
+    {
+        _check_index(i, length);
+        return elements[i];
+    }
+    auto size() const -> std::size_t { return length; }
+    auto cap() const -> std::size_t { return capacity; }
+    auto begin() const -> T* { return elements; }
+    auto end() const -> T* { return begin() + length; }
+    auto operator==(std::nullptr_t) const -> bool { return !owner && !elements; }
+    auto operator!=(std::nullptr_t) const -> bool { return !(*this == nullptr); }
+
+    // append returns a slice with the given elements added at the end,
+    // which uses the same array if there is room for the elements
+    auto append(_slice const& elements) const -> _slice
+    {
+        // The elements may be a part of the same array
+        std::vector<T> added(elements.begin(), elements.end());
+        if (length + added.size() <= capacity) {
+            std::copy(added.begin(), added.end(), end());
+            return _slice(owner, this->elements, length + added.size(), capacity);
+        }
+        auto newCapacity = std::max(length + added.size(), capacity * 2);
+        auto newData = std::make_shared<std::vector<T>>(newCapacity);
+        std::copy(begin(), end(), newData->begin());
+        std::copy(added.begin(), added.end(), newData->begin() + length);
+        return _slice(newData, length + added.size());
+    }
+
+    // slice returns the slice with the elements from low to high, and a
+    // capacity up to max, which uses the same array
+    auto slice(std::size_t low, std::size_t high, std::size_t max) const -> _slice
+    {
+        return _slice(owner, elements + low, high - low, max - low);
+    }
+
+private:
+    std::shared_ptr<void> owner;
+    T* elements = nullptr;
+    std::size_t length = 0;
+    std::size_t capacity = 0;
+};
+
+template <typename T> inline auto _slice_append_all(_slice<T> const& s, _slice<T> const& elements) -> _slice<T>
+{
+    return s.append(elements);
+}
+
+template <typename T, typename... U> inline auto _slice_append(_slice<T> const& s, U... elements) -> _slice<T>
+{
+    return s.append(_slice<T> { static_cast<T>(elements)... });
+}
+
+[[noreturn]] inline void _slice_bounds_panic(std::string const& bounds)
+{
+    throw _panic_error { "runtime error: slice bounds out of range " + bounds };
+}
+
+// _slice_expr is the slice expression s[low:high:max], where high and max
+// are the capacity of s if they are not given
+template <typename T> inline auto _slice_expr(_slice<T> const& s, std::int64_t low, std::int64_t high, std::int64_t max) -> _slice<T>
+{
+    auto capacity = static_cast<std::int64_t>(s.cap());
+    if (max < 0) {
+        _slice_bounds_panic("[::" + std::to_string(max) + "]");
+    }
+    if (max > capacity) {
+        _slice_bounds_panic("[::" + std::to_string(max) + "] with capacity " + std::to_string(capacity));
+    }
+    if (high < 0) {
+        _slice_bounds_panic("[:" + std::to_string(high) + ":]");
+    }
+    if (high > max) {
+        _slice_bounds_panic("[:" + std::to_string(high) + ":" + std::to_string(max) + "]");
+    }
+    if (low < 0) {
+        _slice_bounds_panic("[" + std::to_string(low) + "::]");
+    }
+    if (low > high) {
+        _slice_bounds_panic("[" + std::to_string(low) + ":" + std::to_string(high) + ":]");
+    }
+    return s.slice(low, high, max);
+}
+
+// _check_slice_bounds checks the bounds of the slice expression x[low:high],
+// where size is the capacity of a slice or the length of a string
+inline void _check_slice_bounds(std::int64_t low, std::int64_t high, std::int64_t size, char const* sizeName)
+{
+    if (high < 0) {
+        _slice_bounds_panic("[:" + std::to_string(high) + "]");
+    }
+    if (high > size) {
+        _slice_bounds_panic("[:" + std::to_string(high) + "] with " + sizeName + " " + std::to_string(size));
+    }
+    if (low < 0) {
+        _slice_bounds_panic("[" + std::to_string(low) + ":]");
+    }
+    if (low > high) {
+        _slice_bounds_panic("[" + std::to_string(low) + ":" + std::to_string(high) + "]");
+    }
+}
+
+template <typename T> inline auto _slice_expr(_slice<T> const& s, std::int64_t low, std::int64_t high) -> _slice<T>
+{
+    _check_slice_bounds(low, high, s.cap(), "capacity");
+    return s.slice(low, high, s.cap());
+}
+
+template <typename T> inline auto _slice_expr(_slice<T> const& s, std::int64_t low) -> _slice<T>
+{
+    return _slice_expr(s, low, s.size());
+}
+
+template <typename T, std::size_t N> struct _array;
+
+// _slice_expr is the slice expression a[low:high:max] for an array, which
+// shares the elements of the array
+template <typename T, std::size_t N> inline auto _slice_expr(_array<T, N>& a, std::int64_t low, std::int64_t high, std::int64_t max) -> _slice<T>
+{
+    return _slice_expr(_slice<T>(nullptr, a.data(), N, N), low, high, max);
+}
+
+template <typename T, std::size_t N> inline auto _slice_expr(_array<T, N>& a, std::int64_t low, std::int64_t high) -> _slice<T>
+{
+    return _slice_expr(_slice<T>(nullptr, a.data(), N, N), low, high);
+}
+
+template <typename T, std::size_t N> inline auto _slice_expr(_array<T, N>& a, std::int64_t low) -> _slice<T>
+{
+    return _slice_expr(a, low, N);
+}
+
+// _slice_expr is the slice expression s[low:high] for a string
+inline auto _slice_expr(std::string const& s, std::int64_t low, std::int64_t high) -> std::string
+{
+    _check_slice_bounds(low, high, s.size(), "length");
+    return s.substr(low, high - low);
+}
+
+inline auto _slice_expr(std::string const& s, std::int64_t low) -> std::string
+{
+    return _slice_expr(s, low, s.size());
+}`,
+		"_array<": `// _array is a Go array, a value with a fixed number of elements
+template <typename T, std::size_t N> struct _array : std::array<T, N> {
+    auto operator[](std::int64_t i) -> T&
+    {
+        _check_index(i, N);
+        return std::array<T, N>::operator[](i);
+    }
+    auto operator[](std::int64_t i) const -> T const&
+    {
+        _check_index(i, N);
+        return std::array<T, N>::operator[](i);
+    }
+    constexpr auto cap() const -> std::size_t { return N; }
+};
+
+namespace std {
+// Arrays are hashed by their elements, so that they can be map keys
+template <typename T, std::size_t N> struct hash<_array<T, N>> {
+    auto operator()(_array<T, N> const& a) const -> std::size_t
+    {
+        std::size_t h = 0;
+        for (auto const& x : a) {
+            h ^= std::hash<T> {}(x) + 0x9e3779b9 + (h << 6) + (h >> 2);
+        }
+        return h;
+    }
+};
+}`,
+		"_len(": `// _len returns the length of a string, slice, array or map.
+// The length of an array is a constant.
+template <typename T> constexpr auto _len(T const& x) -> std::int64_t
+{
+    if constexpr (std::is_convertible<T, std::string_view>::value) {
+        return std::string_view(x).size();
+    } else {
+        return std::size(x);
+    }
+}`,
+		"_cap(": `// _cap returns the capacity of a slice or an array
+template <typename T> inline auto _cap(T const& x) -> std::int64_t
+{
+    if constexpr (requires { x.cap(); }) {
+        return x.cap();
+    } else {
+        return std::size(x);
+    }
+}`,
+		"_chan<": channelRuntime,
+		"_map_lookup(": `// _map_lookup returns the value for a key in a map, or the zero value, and if the key is in the map
+template <typename M> inline auto _map_lookup(M const& m, typename M::key_type const& key) -> std::tuple<typename M::mapped_type, bool>
+{
+    auto it = m.find(key);
+    if (it == m.end()) {
+        return { typename M::mapped_type {}, false };
+    }
+    return { it->second, true };
+}`,
+		"_stack(": `// _stack returns a pointer to a temporary value, which lives until the
+// end of the full expression
+template <typename T> inline auto _stack(T&& value) -> T* { return &value; }`,
+		"_sort_slice(": `// _sort_slice sorts a slice with the given less function, like sort.SliceStable.
+// The order is found first, since less compares the elements at indices in the slice.
+template <typename T, typename F> inline void _sort_slice(T const& x, F const& less)
+{
+    std::vector<int> order(std::size(x));
+    std::iota(order.begin(), order.end(), 0);
+    std::stable_sort(order.begin(), order.end(), [&](int i, int j) { return less(i, j); });
+    std::vector<std::decay_t<decltype(x[0])>> sorted;
+    for (auto i : order) {
+        sorted.push_back(x[i]);
+    }
+    std::copy(sorted.begin(), sorted.end(), std::begin(x));
+}`,
+		"_printf_arg(": `// _printf_arg converts strings to C strings, for printf
+template <typename T> inline auto _printf_arg(T const& x)
+{
+    if constexpr (std::is_same<T, std::string>::value) {
+        return x.c_str();
+    } else {
+        return x;
+    }
+}`,
+		"_hash_combine(": `// _hash_value returns a hash of a value that can be a map key
+template <typename T> inline auto _hash_value(T const& x) -> std::size_t
+{
+    if constexpr (requires { x._hash(); }) {
+        return x._hash();
+    } else if constexpr (requires { std::hash<T> {}(x); }) {
+        // Arrays are hashed by their elements, by the std::hash specialization for _array
+        return std::hash<T> {}(x);
+    } else {
+        return 0;
+    }
+}
+
+// _hash_combine combines the hash of a value with the hash h
+template <typename T> inline void _hash_combine(std::size_t& h, T const& x)
+{
+    h ^= _hash_value(x) + 0x9e3779b9 + (h << 6) + (h >> 2);
+}
+
+namespace std {
+// Structs that can be compared are hashed by their fields, so that they can be map keys
+template <typename T>
+    requires requires(T const& x) { x._hash(); }
+struct hash<T> {
+    auto operator()(T const& x) const -> std::size_t { return x._hash(); }
+};
+}`,
+		"_complement(": `// _complement returns the bitwise complement of x, with the same type as x
+template <typename T> inline auto _complement(T x) -> T { return ~x; }`,
+		"_complex(": `template <typename T, typename U> inline auto _complex(T re, U im)
+{
+    // complex(float32, float32) is a complex64, the rest are complex128
+    using F = std::conditional_t<std::is_same<T, float>::value && std::is_same<U, float>::value, float, double>;
+    return std::complex<F>(re, im);
+}`,
+		"std::complex": `// Arithmetic and comparisons between complex numbers and other numbers, as for untyped constants in Go
+#define _COMPLEX_OPERATOR(op) \
+template <typename T, typename U, typename = std::enable_if_t<std::is_arithmetic<U>::value && !std::is_same<T, U>::value>> \
+inline auto operator op(std::complex<T> const& a, U b) { return a op static_cast<T>(b); } \
+template <typename T, typename U, typename = std::enable_if_t<std::is_arithmetic<U>::value && !std::is_same<T, U>::value>> \
+inline auto operator op(U a, std::complex<T> const& b) { return static_cast<T>(a) op b; }
+_COMPLEX_OPERATOR(+) _COMPLEX_OPERATOR(-) _COMPLEX_OPERATOR(*) _COMPLEX_OPERATOR(/)
+_COMPLEX_OPERATOR(==) _COMPLEX_OPERATOR(!=)
+#undef _COMPLEX_OPERATOR`,
 	}
 	if useFormatOutput && !haveStructs {
-		replacements["_format_output"] = `template <typename T> void _format_output(std::ostream& out, T x)
+		replacements["_format_output"] = formatFloat + `
+template <typename T> void _format_output(std::ostream& out, T x)
 {
+    if constexpr (std::is_pointer<T>::value) {
+        if (x == nullptr) {
+            out << "<nil>";
+            return;
+        }
+    }
     if constexpr (std::is_same<T, bool>::value) {
         out << std::boolalpha << x << std::noboolalpha;
     } else if constexpr (std::is_integral<T>::value) {
-        out << static_cast<int>(x);
+        out << +x; // promote char types to int
+    } else if constexpr (std::is_floating_point<T>::value) {
+        out << _format_float(x);
+    } else if constexpr (_is_complex<T>::value) {
+        out << _format_complex(x);
+    } else if constexpr (requires { x.cap(); }) {
+        // Slices and arrays are printed like [1 2 3]
+        out << "[";
+        for (std::size_t i = 0; i < x.size(); i++) {
+            if (i > 0) {
+                out << " ";
+            }
+            _format_output(out, x[i]);
+        }
+        out << "]";
     } else {
         out << x;
     }
 }`
 	}
+	replacements["_log_fatal"] = logFatal
+	if garbageCollector {
+		replacements["_gc_"] = gcRuntime
+	} else {
+		replacements["_gc_"] = noGCRuntime
+	}
 	for k, v := range replacements {
-		if strings.Contains(output, k) {
+		// Check the given source, since the added functions may contain the keys
+		if strings.Contains(source, k) {
 			output = strings.Replace(output, k, strings.Replace(k, ".", "", -1), -1)
 			output = v + "\n" + output
 		}
 	}
+	// The runtime checks of the added functions may also panic, so the
+	// panics are added before all of them
+	for _, k := range []string{"_panic", "_check_index(", "_divisor("} {
+		if strings.Contains(output, k) {
+			output = panicRuntime + "\n" + output
+			break
+		}
+	}
 	return output
 }
 
 // FunctionArguments transforms the arguments given to a function
 func FunctionArguments(source string) string {
-	output := source
-	if strings.Contains(output, ",") {
-		currentName := ""
-		currentType := ""
-		args := strings.Split(output, ",")
-		for i := len(args) - 1; i >= 0; i-- {
-			strippedArg := strings.TrimSpace(args[i])
-			//fmt.Println(i, strippedArg)
-			if strings.Contains(strippedArg, " ") {
-				elems := strings.SplitN(strippedArg, " ", 2)
-				currentName = elems[0]
-				currentType = elems[1]
-			} else {
-				currentName = strippedArg
-			}
-			newArgs := " " + currentType + " " + currentName
-			output = strings.Replace(output, args[i], newArgs, -1)
+	if strings.TrimSpace(source) == "" {
+		return ""
+	}
+	args := splitTopLevel(source, ',')
+	if !namedArguments(args) {
+		// Only types, like for unnamed return values
+		for i, arg := range args {
+			args[i] = TypeReplace(arg)
 		}
-	} else if strings.Contains(output, " ") {
-		words := strings.Split(output, " ")
-		output = strings.TrimSpace(words[1]) + " " + strings.TrimSpace(words[0])
+		return strings.Join(args, ", ")
+	}
+	// In Go, the type is given after the last name that has that type
+	currentType := ""
+	for i := len(args) - 1; i >= 0; i-- {
+		elems := strings.SplitN(args[i], " ", 2)
+		if len(elems) == 2 {
+			currentType = TypeReplace(elems[1])
+		}
+		args[i] = currentType + " " + elems[0]
 	}
-	return strings.TrimSpace(output)
+	return strings.Join(args, ", ")
+}
+
+// namedArguments checks if the given Go function arguments have names
+func namedArguments(args []string) bool {
+	for _, arg := range args {
+		if strings.Contains(arg, " ") && !strings.HasPrefix(arg, "func") {
+			return true
+		}
+	}
+	return false
+}
+
+// argumentNamesAndTypes returns the names and the C++ types of the given Go
+// function arguments, or nil if the arguments have no names
+func argumentNamesAndTypes(source string) ([]string, []string) {
+	if strings.TrimSpace(source) == "" || !namedArguments(splitTopLevel(source, ',')) {
+		return nil, nil
+	}
+	var names, types []string
+	for _, arg := range splitTopLevel(FunctionArguments(source), ',') {
+		pos := strings.LastIndex(arg, " ")
+		names = append(names, arg[pos+1:])
+		types = append(types, arg[:pos])
+	}
+	return names, types
 }
 
 // FunctionRetvals transforms the return values from a function
@@ -199,28 +726,51 @@ func FunctionRetvals(source string) (output string) {
 	if len(strings.TrimSpace(source)) == 0 {
 		return source
 	}
-	output = source
-	if strings.Contains(output, "(") {
-		s := greedyBetween(output, "(", ")")
-		retvals := FunctionArguments(s)
+	output = strings.TrimSpace(source)
+	if strings.HasPrefix(output, "(") {
+		retvals := FunctionArguments(output[1:matchingParenthesis(output, 0)])
+		if _, types := argumentNamesAndTypes(output[1:matchingParenthesis(output, 0)]); types != nil {
+			// Named results
+			retvals = strings.Join(types, ", ")
+		}
 		if strings.Contains(retvals, ",") {
 			output = "(" + retvals + ")"
 		} else {
 			output = retvals
 		}
+	} else {
+		output = TypeReplace(output)
 	}
 	return strings.TrimSpace(output)
 }
 
-// CPPTypes picks out the types given a list of C++ arguments with name and type
-func CPPTypes(args string) string {
-	words := strings.Split(leftBetween(args, "(", ")"), ",")
-	var atypes []string
-	for _, word := range words {
-		elems := strings.Split(strings.TrimSpace(word), " ")
-		atypes = append(atypes, elems[0])
+// CPPTypes returns the types in a parenthesized list of C++ return types,
+// like (int, std::string)
+func CPPTypes(rets string) string {
+	rets = strings.TrimSpace(rets)
+	return strings.TrimSpace(rets[1 : len(rets)-1])
+}
+
+// MultiLineSignature joins the lines of a function signature where the
+// parameters continue on the following lines, like for a parameter with an
+// anonymous struct type. Returns the joined line and the number of following
+// lines that were joined.
+func MultiLineSignature(line string, following []string) (string, int) {
+	joined := strings.TrimSpace(line)
+	if !strings.HasPrefix(joined, "func ") {
+		return line, 0
+	}
+	depth := strings.Count(joined, "(") - strings.Count(joined, ")")
+	lines := []string{joined}
+	for i := 0; depth > 0 && i < len(following); i++ {
+		code, _, _ := splitComment(following[i], false)
+		lines = append(lines, code)
+		depth += strings.Count(code, "(") - strings.Count(code, ")")
+		if depth <= 0 {
+			return joinLines(lines), i + 1
+		}
 	}
-	return strings.Join(atypes, ", ")
+	return line, 0
 }
 
 // FunctionSignature transforms a function signature that spans one line
@@ -230,23 +780,20 @@ func FunctionSignature(source string) (output, returntype, name string) {
 		return source, "", ""
 	}
 	output = source
-	args := FunctionArguments(leftBetween(output, "(", ")"))
-	// Has return values in a parenthesis
-	var rets string
-	if strings.Contains(output, ") (") {
-		// There is a parenthesis with return types in the function signature
-		rets = FunctionRetvals(between(output, ")", "{", false, true))
-	} else {
-		// There is not a parenthesis with return types in the function signature
-		rets = FunctionRetvals(between(output, ")", "{", true, true))
-	}
-	if strings.Contains(rets, ",") {
+	argsStart := strings.Index(output, "(")
+	argsEnd := matchingParenthesis(output, argsStart)
+	args := FunctionArguments(output[argsStart+1 : argsEnd])
+	// The return values are between the arguments and the opening curly bracket
+	rets := FunctionRetvals(strings.TrimSuffix(strings.TrimSpace(output[argsEnd+1:]), "{"))
+	if strings.HasPrefix(rets, "(") {
 		// Multiple return
 		rets = tupleType + "<" + CPPTypes(rets) + ">"
 	}
 	name = leftBetween(output, "func ", "(")
 	if name == "main" {
 		rets = "int"
+	} else if rets == "" {
+		rets = "void"
 	}
 	output = "auto " + name + "(" + args + ") -> " + rets + " {"
 	return strings.TrimSpace(output), rets, name
@@ -288,60 +835,354 @@ func splitAtAndTrim(s string, poss []int) []string {
 	return l
 }
 
-// Split arguments. Handles quoting 1 level deep.
+// Split arguments. Handles quoting and nested parentheses, brackets and
+// braces, like in sum(_slice<int>{sum(_slice<int>{1, 2}), 3}).
 func SplitArgs(s string) []string {
-	inQuote := false
-	inSingleQuote := false
-	inPar := false
-	inCurly := false
-	var args []string
-	word := ""
-	for _, letter := range s {
-		switch letter {
-		case '"':
-			inQuote = !inQuote
-		case '\'':
-			inSingleQuote = !inSingleQuote
-		}
-		if letter == '(' && !inQuote && !inSingleQuote && !inPar && !inCurly {
-			inPar = true
-		}
-		if letter == ')' && !inQuote && !inSingleQuote {
-			inPar = false
-		}
-		if letter == '{' && !inQuote && !inSingleQuote && !inPar && !inCurly {
-			inCurly = true
-		}
-		if letter == '}' && !inQuote && !inSingleQuote {
-			inCurly = false
-		}
-		if letter == ',' && !inQuote && !inSingleQuote && !inPar && !inCurly {
-			args = append(args, strings.TrimSpace(word))
-			word = ""
+	return splitTopLevel(s, ',')
+}
+
+func isNum(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return len(s) > 0 && scanNumericLiteral(s, 0) == len(s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierChar(c byte) bool {
+	return isDigit(c) || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// scanNumericLiteral returns the position right after the Go numeric literal
+// that starts at the given position, or the same position if there is none.
+func scanNumericLiteral(s string, pos int) int {
+	if pos >= len(s) || !(isDigit(s[pos]) || (s[pos] == '.' && pos+1 < len(s) && isDigit(s[pos+1]))) {
+		return pos
+	}
+	isHex := strings.HasPrefix(strings.ToLower(s[pos:]), "0x")
+	i := pos
+	for i < len(s) && (isIdentifierChar(s[i]) || s[i] == '.') {
+		c := s[i] | 0x20 // lowercase
+		i++
+		// Handle the sign of an exponent
+		if ((c == 'e' && !isHex) || (c == 'p' && isHex)) && i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+	}
+	return i
+}
+
+// NumericLiteral transforms a Go numeric literal to an equivalent C++ literal
+func NumericLiteral(literal string) string {
+	literal = strings.Replace(literal, "_", "", -1)
+	lower := strings.ToLower(literal)
+	if strings.HasSuffix(lower, "i") {
+		// Imaginary literal. For backwards compatibility, 0123i is decimal in Go.
+		imag := literal[:len(literal)-1]
+		if strings.Trim(imag, "0123456789") == "" {
+			imag = strings.TrimLeft(imag, "0")
+			if imag == "" {
+				imag = "0"
+			}
+		}
+		return "std::complex<double>(0, " + NumericLiteral(imag) + ")"
+	}
+	if strings.HasPrefix(lower, "0o") {
+		// Octal literals only have a leading 0 in C++
+		literal = "0" + literal[2:]
+		lower = "0" + lower[2:]
+	}
+	if strings.ContainsAny(lower, ".p") || (!strings.HasPrefix(lower, "0x") && strings.Contains(lower, "e")) {
+		// Floating point literals, including hexadecimal ones, are the same in C++17
+		return literal
+	}
+	// Integer literals are of type int in Go, which is 64 bits. In C++, an integer
+	// literal is an int, which is too small and may make a function from the
+	// standard library a better match than a function with the same name in the
+	// Go code. C++ may also pick an unsigned type for non-decimal literals that do
+	// not fit in an int, so use the decimal form.
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(lower, "0b"), "0x"), integerBase(lower), 64)
+	if err != nil || n > math.MaxInt64 {
+		// Only an untyped constant can be this large
+		return literal
+	}
+	if n > math.MaxInt32 {
+		literal = strconv.FormatUint(n, 10)
+	}
+	return TypeReplace("int") + "(" + literal + ")"
+}
+
+// integerBase returns the base of the given lowercase Go integer literal
+func integerBase(lower string) int {
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		return 16
+	case strings.HasPrefix(lower, "0b"):
+		return 2
+	case len(lower) > 1 && lower[0] == '0':
+		return 8
+	}
+	return 10
+}
+
+// variadicFunction is a function with a variadic parameter
+type variadicFunction struct {
+	parameterCount int    // the number of parameters before the variadic parameter
+	elementType    string // the C++ type of the elements of the variadic parameter
+}
+
+// variadicFunctions are the functions with variadic parameters in the source code
+var variadicFunctions = map[string]variadicFunction{}
+
+// VariadicFunction checks if the given Go function declaration has a variadic
+// parameter, and if so, adds the function to variadicFunctions
+func VariadicFunction(source string) {
+	source = strings.TrimSpace(source)
+	argsStart := strings.Index(source, "(")
+	if !strings.HasPrefix(source, "func ") || argsStart <= len("func ") || matchingParenthesis(source, argsStart) == -1 {
+		return
+	}
+	args := splitTopLevel(source[argsStart+1:matchingParenthesis(source, argsStart)], ',')
+	last := strings.Fields(args[len(args)-1])
+	if len(last) != 2 || !strings.HasPrefix(last[1], "...") {
+		return
+	}
+	name := strings.TrimSpace(source[len("func "):argsStart])
+	variadicFunctions[name] = variadicFunction{len(args) - 1, TypeReplace(last[1][len("..."):])}
+}
+
+// VariadicCalls transforms the calls to functions with variadic parameters in
+// a line of Go code. The variadic arguments are placed in a slice, while
+// f(xs...) passes on the slice xs as it is. Calls to append are also transformed.
+func VariadicCalls(code string) string {
+	var sb strings.Builder
+	written := 0 // the code up to this position is written
+	for _, t := range tokens(code) {
+		if t.pos < written || !t.isName() || t.selected(code) {
+			continue
+		}
+		name := code[t.pos:t.end]
+		f, variadic := variadicFunctions[name]
+		argsEnd := -1
+		if t.end < len(code) && code[t.end] == '(' && (variadic || name == "append") {
+			argsEnd = matchingParenthesis(code, t.end)
+		}
+		if argsEnd == -1 {
+			continue
+		}
+		sb.WriteString(code[written:t.pos])
+		written = argsEnd + 1
+		var args []string
+		if inner := strings.TrimSpace(code[t.end+1 : argsEnd]); inner != "" {
+			for _, arg := range splitTopLevel(inner, ',') {
+				args = append(args, VariadicCalls(arg))
+			}
+		}
+		spread := len(args) > 0 && strings.HasSuffix(args[len(args)-1], "...")
+		if spread {
+			args[len(args)-1] = strings.TrimSuffix(args[len(args)-1], "...")
+		}
+		switch {
+		case name == "append" && len(args) == 1:
+			sb.WriteString(args[0])
+		case name == "append" && spread:
+			// for example: append(a, b...)
+			sb.WriteString("_slice_append_all(" + strings.Join(args, ", ") + ")")
+		case name == "append":
+			sb.WriteString("_slice_append(" + strings.Join(args, ", ") + ")")
+		case spread:
+			// for example: sum(xs...)
+			sb.WriteString(name + "(" + strings.Join(args, ", ") + ")")
+		default:
+			// for example: sum(1, 2, 3)
+			fixed := args
+			if len(fixed) > f.parameterCount {
+				fixed = args[:f.parameterCount]
+			}
+			variadicArgs := "_slice<" + f.elementType + ">{" + strings.Join(args[len(fixed):], ", ") + "}"
+			sb.WriteString(name + "(" + strings.Join(append(fixed, variadicArgs), ", ") + ")")
+		}
+	}
+	sb.WriteString(code[written:])
+	return sb.String()
+}
+
+// builtinFunctions maps Go builtin functions and functions from the standard
+// library to C++ functions that take the same arguments. The functions in
+// math/cmplx only take complex128 arguments, hence the template arguments.
+var builtinFunctions = map[string]string{
+	"len":         "_len",
+	"cap":         "_cap",
+	"close":       "_close",
+	"complex":     "_complex",
+	"real":        "std::real",
+	"imag":        "std::imag",
+	"cmplx.Abs":   "std::abs<double>",
+	"cmplx.Acos":  "std::acos<double>",
+	"cmplx.Acosh": "std::acosh<double>",
+	"cmplx.Asin":  "std::asin<double>",
+	"cmplx.Asinh": "std::asinh<double>",
+	"cmplx.Atan":  "std::atan<double>",
+	"cmplx.Atanh": "std::atanh<double>",
+	"cmplx.Conj":  "std::conj<double>",
+	"cmplx.Cos":   "std::cos<double>",
+	"cmplx.Cosh":  "std::cosh<double>",
+	"cmplx.Exp":   "std::exp<double>",
+	"cmplx.Log":   "std::log<double>",
+	"cmplx.Log10": "std::log10<double>",
+	"cmplx.Phase": "std::arg<double>",
+	"cmplx.Pow":   "std::pow<double>",
+	"cmplx.Rect":  "std::polar<double>",
+	"cmplx.Sin":   "std::sin<double>",
+	"cmplx.Sinh":  "std::sinh<double>",
+	"cmplx.Sqrt":  "std::sqrt<double>",
+	"cmplx.Tan":   "std::tan<double>",
+	"cmplx.Tanh":  "std::tanh<double>",
+
+	"panic":                "_panic",
+	"os.Exit":              "std::exit",
+	"log.Fatal":            "_log_fatal",
+	"log.Fatalf":           "_log_fatalf",
+	"log.Fatalln":          "_log_fatalln",
+	"sort.Slice":           "_sort_slice",
+	"sort.SliceStable":     "_sort_slice",
+	"runtime.GC":           "_gc_collect",
+	"runtime.ReadMemStats": "_gc_read_mem_stats",
+}
+
+// FunctionCalls replaces calls to the functions in builtinFunctions, type
+// conversions and nil in a line of Go code, without touching string literals,
+// methods or other identifiers.
+func FunctionCalls(code string) string {
+	var sb strings.Builder
+	written := 0 // the code up to this position is written
+	toks := tokens(code)
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if !t.isName() || t.selected(code) {
+			continue
+		}
+		// Find the end of this, possibly qualified, identifier
+		end := t.end
+		for i+2 < len(toks) && toks[i+1].tok == token.PERIOD && toks[i+1].pos == end && toks[i+2].isName() && toks[i+2].pos == end+1 {
+			end = toks[i+2].end
+			i += 2
+		}
+		name := code[t.pos:end]
+		replacement := name
+		if builtin, ok := builtinFunctions[name]; ok && end < len(code) && code[end] == '(' {
+			replacement = builtin
+		} else if name == "nil" {
+			replacement = "nullptr"
+		} else if cppType := TypeReplace(name); cppType != name && name != "string" && end < len(code) && code[end] == '(' {
+			// Type conversion
+			if strings.Contains(cppType, " ") {
+				cppType = "(" + cppType + ")"
+			}
+			replacement = cppType
+		}
+		sb.WriteString(code[written:t.pos] + replacement)
+		written = end
+	}
+	sb.WriteString(code[written:])
+	return sb.String()
+}
+
+// NumericLiterals transforms all numeric literals in a line of Go code to C++ literals
+func NumericLiterals(code string) string {
+	var sb strings.Builder
+	written := 0 // the code up to this position is written
+	toks := tokens(code)
+	for i, t := range toks {
+		if t.tok != token.INT && t.tok != token.FLOAT && t.tok != token.IMAG {
+			continue
+		}
+		end := t.end
+		if i+1 < len(toks) && toks[i+1].tok == token.IDENT && toks[i+1].pos == end {
+			// A C++ literal with a suffix, like 1.5f, is left as it is by NumericLiteral
+			end = toks[i+1].end
+		}
+		sb.WriteString(code[written:t.pos])
+		if t.pos > 0 && code[t.pos-1] == '[' && end < len(code) && code[end] == ']' {
+			// The length of an array type, like [4]int, or a constant index
+			sb.WriteString(code[t.pos:end])
 		} else {
-			word += string(letter)
+			sb.WriteString(NumericLiteral(code[t.pos:end]))
 		}
+		written = end
 	}
-	args = append(args, strings.TrimSpace(word))
-	return args
+	sb.WriteString(code[written:])
+	return sb.String()
 }
 
-func isNum(s string) bool {
-	_, err := strconv.ParseFloat(s, 64)
-	isFloat := (err == nil)
-	_, err = strconv.ParseInt(s, 0, 64)
-	isInt := (err == nil)
-	return isFloat || isInt
+// isStringLiteral checks if the given Go expression is a string literal
+func isStringLiteral(expression string) bool {
+	literal, err := parser.ParseExpr(expression)
+	if err != nil {
+		return false
+	}
+	basicLiteral, ok := literal.(*ast.BasicLit)
+	return ok && basicLiteral.Kind == token.STRING
 }
 
-// stripSingleLineComment will strip away trailing single-line comments
-func stripSingleLineComment(line string) string {
-	commentMarker := "//"
-	if strings.Count(line, commentMarker) == 1 {
-		p := strings.Index(line, commentMarker)
-		return strings.TrimSpace(line[:p])
+// isIterator checks if the given Go expression has a function type that can
+// be ranged over, like iter.Seq[V] or func(yield func(V) bool)
+func isIterator(expression string) bool {
+	expr, err := parser.ParseExpr(expression)
+	if err != nil {
+		return false
 	}
-	return line
+	text := func(n ast.Node) string {
+		return expression[n.Pos()-1 : n.End()-1]
+	}
+	t := underlyingType(typeOf(expr, text, currentVariables()))
+	return strings.HasPrefix(t, "iter.Seq") || strings.HasPrefix(t, "func(yield func(")
+}
+
+// splitComment scans a line of Go code and separates the code from the comments.
+// inBlock specifies if a /* block comment */ was left open by a previous line.
+// Comment markers within string, raw string and rune literals are left alone.
+// Returns the code, the comments (using the same syntax as C++) and true if
+// a block comment is still open at the end of the line.
+func splitComment(line string, inBlock bool) (string, string, bool) {
+	var comments []string
+	if inBlock {
+		end := strings.Index(line, "*/")
+		if end == -1 {
+			return "", strings.TrimSpace(line), true
+		}
+		comments = append(comments, strings.TrimSpace(line[:end+len("*/")]))
+		line = line[end+len("*/"):]
+		inBlock = false
+	}
+	var code strings.Builder
+	written := 0 // the code up to this position is written
+	for _, t := range tokens(line) {
+		if t.tok != token.COMMENT {
+			continue
+		}
+		code.WriteString(line[written:t.pos])
+		comment := line[t.pos:t.end]
+		if strings.HasPrefix(comment, "//") {
+			comments = append(comments, strings.TrimSpace(comment))
+			return strings.TrimSpace(code.String()), strings.Join(comments, " "), false
+		}
+		comments = append(comments, strings.TrimSpace(comment))
+		code.WriteByte(' ')
+		written = t.end
+		// A block comment that is not closed continues on the next line
+		inBlock = len(comment) < len("/**/") || !strings.HasSuffix(comment, "*/")
+	}
+	code.WriteString(line[written:])
+	return strings.TrimSpace(code.String()), strings.Join(comments, " "), inBlock
+}
+
+// hasComment checks if the last line of the given C++ code has a comment
+func hasComment(cppCode string) bool {
+	lines := strings.Split(cppCode, "\n")
+	_, comment, _ := splitComment(lines[len(lines)-1], false)
+	return comment != ""
 }
 
 // Will return the transformed string, and a bool if pretty printing may be needed
@@ -391,6 +1232,13 @@ func PrintStatement(source string) (string, bool) {
 		output := source
 		// TODO: Also support fmt.Fprintf, and format %v values differently.
 		//       Converting to an iostream expression is one possibility.
+		if fname == "fmt.Printf" && len(args) > 1 {
+			// Strings are given to printf as C strings
+			for i := range args[1:] {
+				args[i+1] = "_printf_arg(" + args[i+1] + ")"
+			}
+			output = "printf(" + strings.Join(args, ", ") + ")"
+		}
 		output = strings.Replace(output, "fmt.Printf", "printf", 1)
 		output = strings.Replace(output, "fmt.Fprintf", "fprintf", 1)
 		output = strings.Replace(output, "fmt.Sprintf", "sprintf", 1)
@@ -482,12 +1330,13 @@ func AddIncludes(source string) (output string) {
 	output = source
 	includes := map[string]string{
 		"std::tuple":                       "tuple",
+		"std::make_tuple":                  "tuple",
+		"std::tie":                         "tuple",
 		"std::endl":                        "iostream",
 		"std::cout":                        "iostream",
 		"std::string":                      "string",
 		"std::size":                        "iterator",
 		"std::unordered_map":               "unordered_map",
-		"std::hash":                        "functional",
 		"std::size_t":                      "cstddef",
 		"std::int8_t":                      "cinttypes",
 		"std::int16_t":                     "cinttypes",
@@ -504,196 +1353,1244 @@ func AddIncludes(source string) (output string) {
 		"std::stringstream":                "sstream",
 		"std::is_pointer":                  "type_traits",
 		"std::experimental::is_detected_v": "experimental/type_traits",
-		// TODO: complex64, complex128
+		"std::complex":                     "complex",
+		"std::function":                    "functional",
+		"std::hash":                        "functional",
+		"std::views":                       "ranges",
+		"std::vector":                      "vector",
+		"std::string_view":                 "string_view",
+		"std::pair":                        "utility",
+		"std::shared_ptr":                  "memory",
+		"std::make_shared":                 "memory",
+		"std::initializer_list":            "initializer_list",
+		"std::array":                       "array",
+		"std::cerr":                        "iostream",
+		"std::exit":                        "cstdlib",
+		"std::move":                        "utility",
+		"std::max":                         "algorithm",
+		"std::to_chars":                    "charconv",
+		"std::isnan":                       "cmath",
+		"std::malloc":                      "cstdlib",
+		"std::uintptr_t":                   "cstdint",
+		"std::jmp_buf":                     "csetjmp",
+		"std::sort":                        "algorithm",
+		"std::stable_sort":                 "algorithm",
+		"std::iota":                        "numeric",
+		"std::is_convertible":              "type_traits",
+		"std::strftime":                    "ctime",
+		"std::deque":                       "deque",
+		"operator new":                     "new",
+	}
+	includeString := ""
+	for k, v := range includes {
+		if strings.Contains(output, k) {
+			newInclude := "#include <" + v + ">\n"
+			if !strings.Contains(includeString, newInclude) {
+				includeString += newInclude
+			}
+		}
+	}
+	return includeString + "\n" + output
+}
+
+// IfSentence transforms the first line of an if statement, which may have an
+// init statement. The variables of the init statement are also in the scope of
+// the else branches, both in Go and in C++17.
+func IfSentence(source string) (output string) {
+	output = source
+	init, expression := splitInit(conditionBetween(source, "if"))
+	if init != "" {
+		return "if (" + SimpleStatement(init) + "; " + expression + ") {"
+	}
+	return "if (" + expression + ") {"
+}
+
+func ElseIfSentence(source string) (output string) {
+	output = source
+	init, expression := splitInit(conditionBetween(source, "} else if"))
+	if init != "" {
+		return "} else if (" + SimpleStatement(init) + "; " + expression + ") {"
+	}
+	return "} else if (" + expression + ") {"
+}
+
+// conditionBetween returns what is between the given keyword and the last {
+func conditionBetween(source, keyword string) string {
+	s := strings.TrimSpace(source)
+	s = strings.TrimPrefix(s, keyword)
+	s = strings.TrimSuffix(s, "{")
+	return strings.TrimSpace(s)
+}
+
+// FunctionType transforms a Go function type to a C++ std::function type
+func FunctionType(source string) string {
+	params, rets := functionTypeParts(source)
+	return "std::function<" + rets + "(" + params + ")>"
+}
+
+// functionTypeParts returns the C++ parameters and return type of a Go
+// function type or the signature of a function literal
+func functionTypeParts(source string) (string, string) {
+	paramsEnd := matchingParenthesis(source, len("func"))
+	params := FunctionArguments(source[len("func("):paramsEnd])
+	rets := FunctionRetvals(source[paramsEnd+1:])
+	if rets == "" {
+		rets = "void"
+	} else if strings.HasPrefix(rets, "(") {
+		rets = tupleType + "<" + CPPTypes(rets) + ">"
+	}
+	return params, rets
+}
+
+// functionLiteral returns the position of the next function literal in a
+// string of Go code, starting at the given position, or -1
+func functionLiteral(code string, pos int) int {
+	toks := tokens(code)
+	for i, t := range toks {
+		if t.pos < pos || t.tok != token.FUNC || i+1 == len(toks) || toks[i+1].tok != token.LPAREN || toks[i+1].pos != t.end {
+			continue
+		}
+		// Function types are followed by something else than a body
+		if end := matchingParenthesis(code, t.end); end != -1 {
+			rest := code[end+1:]
+			if body := strings.Index(rest, "{"); body != -1 && !strings.ContainsAny(rest[:body], "=,;)}") {
+				return t.pos
+			}
+		}
+	}
+	return -1
+}
+
+// matchingCurlyBracket returns the position of the curly bracket that closes
+// the curly bracket at the given position, or -1
+func matchingCurlyBracket(s string, pos int) int {
+	depth := 0
+	for _, t := range tokens(s) {
+		if t.pos < pos {
+			continue
+		}
+		switch t.tok {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return t.pos
+			}
+		}
+	}
+	return -1
+}
+
+// FunctionLiterals transforms the function literals in a line of Go code to
+// lambdas that capture variables by reference, like closures do in Go.
+// captures are variables that should also be captured by value.
+// Returns true if the body of the last function literal continues on the
+// following lines.
+func FunctionLiterals(code string, captures []string) (string, bool) {
+	start := functionLiteral(code, 0)
+	if start == -1 {
+		return code, false
+	}
+	bodyStart := start + strings.Index(code[start:], "{")
+	params, rets := functionTypeParts(strings.TrimSpace(code[start:bodyStart]))
+	captureList := strings.Join(append([]string{"&"}, captures...), ", ")
+	lambda := "std::function<" + rets + "(" + params + ")>([" + captureList + "](" + params + ") -> " + rets + " {"
+	bodyEnd := matchingCurlyBracket(code, bodyStart)
+	if bodyEnd == -1 {
+		// for example: f := func() int {
+		return code[:start] + lambda + code[bodyStart+1:], true
+	}
+	// for example: f := func() int { return 42 }
+	body, _ := FunctionLiterals(strings.TrimSpace(code[bodyStart+1:bodyEnd]), captures)
+	if body != "" && !strings.HasSuffix(body, ";") && !strings.HasSuffix(body, "}") {
+		body += ";"
+	}
+	rest, open := FunctionLiterals(code[bodyEnd+1:], captures)
+	return code[:start] + lambda + " " + body + " })" + rest, open
+}
+
+// FunctionLiteralEnd transforms the line that closes the body of a function literal
+func FunctionLiteralEnd(trimmedLine string) string {
+	if trimmedLine == "}" {
+		return "});"
+	}
+	return strings.Replace(trimmedLine, "}", "})", 1)
+}
+
+// capturedVariables returns the identifiers that are used by the function
+// literals in the given lines of Go code
+func capturedVariables(lines []string) []string {
+	code := strings.Join(lines, "\n")
+	var names []string
+	for start := functionLiteral(code, 0); start != -1; start = functionLiteral(code, start+1) {
+		end := matchingCurlyBracket(code, start+strings.Index(code[start:], "{"))
+		if end == -1 {
+			end = len(code)
+		}
+		names = append(names, identifiers(code[start:end])...)
+	}
+	return names
+}
+
+// identifiers returns the identifiers in a string of Go code, outside of literals
+func identifiers(code string) []string {
+	var names []string
+	for _, t := range tokens(code) {
+		if t.isName() && !t.selected(code) {
+			names = append(names, code[t.pos:t.end])
+		}
+	}
+	return names
+}
+
+// replaceIdentifier replaces an identifier in a string of Go code, but not
+// within literals, other identifiers or selectors
+func replaceIdentifier(code, name, replacement string) string {
+	var sb strings.Builder
+	written := 0 // the code up to this position is written
+	for _, t := range tokens(code) {
+		if t.isName() && code[t.pos:t.end] == name && !t.selected(code) {
+			sb.WriteString(code[written:t.pos] + replacement)
+			written = t.end
+		}
+	}
+	sb.WriteString(code[written:])
+	return sb.String()
+}
+
+// blockLines returns the lines of Go code after the given line, up to and
+// including the line where the curly bracket that is opened on the given line
+// is closed
+func blockLines(lines []string, start int) []string {
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		code, _, _ := splitComment(lines[i], false)
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
+		if depth <= 0 {
+			return lines[start+1 : i+1]
+		}
+	}
+	return lines[start+1:]
+}
+
+// GoVersion returns the Go language version that is given by the go.mod file
+// of the module that the given Go source file belongs to, or an empty string
+func GoVersion(filename string) string {
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return ""
+	}
+	for {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "go" {
+					return fields[1]
+				}
+			}
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// PerIterationLoopVariables checks if each iteration of a for loop has its own
+// loop variables in the given Go language version. An empty string is the
+// latest version.
+func PerIterationLoopVariables(version string) bool {
+	fields := strings.SplitN(version, ".", 3)
+	if len(fields) < 2 {
+		return true
+	}
+	major, err1 := strconv.Atoi(fields[0])
+	minor, err2 := strconv.Atoi(strings.TrimRightFunc(fields[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	return major > 1 || minor >= 22
+}
+
+func TypeReplace(source string) string {
+	// TODO: uintptr
+	trimmed := strings.TrimSpace(source)
+	// For pointer types, move the star
+	if strings.HasPrefix(trimmed, "*") {
+		return TypeReplace(trimmed[1:]) + "*"
+	}
+	if strings.HasPrefix(trimmed, "func(") {
+		return FunctionType(trimmed)
+	} else if strings.HasPrefix(trimmed, "[]") {
+		return "_slice<" + TypeReplace(trimmed[len("[]"):]) + ">"
+	} else if strings.HasPrefix(trimmed, "...") {
+		// Variadic parameters are slices
+		return "_slice<" + TypeReplace(trimmed[len("..."):]) + ">"
+	} else if strings.HasPrefix(trimmed, "struct{") || strings.HasPrefix(trimmed, "struct {") {
+		return AnonymousStruct(trimmed)
+	} else if strings.HasPrefix(trimmed, "map[") {
+		keyEnd := matchingBracket(trimmed, len("map"))
+		return "std::unordered_map<" + TypeReplace(trimmed[len("map["):keyEnd]) + ", " + TypeReplace(trimmed[keyEnd+1:]) + ">"
+	} else if strings.HasPrefix(trimmed, "[") {
+		// Arrays, like [4]int. The length may be an untyped float constant, like 5.0.
+		lengthEnd := matchingBracket(trimmed, 0)
+		length := trimmed[1:lengthEnd]
+		if c, err := EvalConstant(length); err == nil {
+			if v, err := representable(c.value, "int"); err == nil {
+				length = v.ExactString()
+			}
+		}
+		return "_array<" + TypeReplace(trimmed[lengthEnd+1:]) + ", " + length + ">"
+	} else if strings.HasPrefix(trimmed, "chan ") || strings.HasPrefix(trimmed, "chan<- ") || strings.HasPrefix(trimmed, "<-chan ") {
+		// Channels, which may be send-only or receive-only
+		return "_chan<" + TypeReplace(trimmed[strings.Index(trimmed, " ")+1:]) + ">"
+	} else if strings.HasPrefix(trimmed, "iter.Seq") && strings.HasSuffix(trimmed, "]") {
+		// iter.Seq[V] and iter.Seq2[K, V]
+		params := FunctionArguments(trimmed[strings.Index(trimmed, "[")+1 : len(trimmed)-1])
+		return "std::function<void(std::function<bool(" + params + ")>)>"
+	}
+	switch trimmed {
+	case "string":
+		return "std::string"
+	case "float64":
+		return "double"
+	case "float32":
+		return "float"
+	case "uint64":
+		return "std::uint64_t"
+	case "uint32":
+		return "std::uint32_t"
+	case "uint16":
+		return "std::uint16_t"
+	case "uint8":
+		return "std::uint8_t"
+	case "int64":
+		return "std::int64_t"
+	case "int32":
+		return "std::int32_t"
+	case "int16":
+		return "std::int16_t"
+	case "int8":
+		return "std::int8_t"
+	case "byte":
+		return "std::uint8_t"
+	case "rune":
+		return "std::int32_t"
+	case "int":
+		// An int in Go is 64 bits
+		return "std::int64_t"
+	case "uint":
+		return "std::uint64_t"
+	case "complex128":
+		return "std::complex<double>"
+	case "complex64":
+		return "std::complex<float>"
+	case "runtime.MemStats":
+		return "_gc_mem_stats"
+	default:
+		return trimmed
+	}
+}
+
+// rangeKeyword returns the position of the range keyword in the expression
+// of a for loop, or -1
+func rangeKeyword(expression string) int {
+	if strings.HasPrefix(expression, "range ") {
+		return 0
+	}
+	for _, prefix := range []string{" range ", "=range "} {
+		if pos := strings.Index(expression, prefix); pos != -1 {
+			return pos + 1
+		}
+	}
+	return -1
+}
+
+// RangeVariable returns a new and unique variable name
+func RangeVariable() string {
+	rangeCounter++
+	return rangePrefix + strconv.Itoa(rangeCounter)
+}
+
+// ForLoop transforms the first line of a for loop. Returns the for loop block,
+// which is an iterator block if the loop ranges over an iterator function,
+// since the loop body is then placed in a function that is called for each
+// iteration.
+//
+// All these variations are supported:
+// * for {
+// * for ;; {
+// * for condition {
+// * for i := 0; i < 10; i++ {
+// * for range x {
+// * for i := range x {
+// * for i, v := range x {
+// * for _, v := range x {
+// * for i, v = range x {
+// where x is a hash map, a slice, an array, a pointer to an array, a string,
+// an integer, or a function that takes a yield function as its argument.
+//
+// Loop variables that are in the captured list are placed on the heap, since
+// function literals in the loop body may use them after the iteration or the
+// loop has ended.
+func ForLoop(source string, encounteredHashMaps, iteratorFunctions, captured []string) (string, *block) {
+	b := &block{}
+	expression := conditionBetween(source, "for")
+	if expression == "" || strings.Replace(expression, " ", "", -1) == ";;" {
+		// endless loop
+		return "for (;;) {", b
+	}
+	rangePos := rangeKeyword(expression)
+	if rangePos == -1 {
+		parts := splitTopLevel(expression, ';')
+		if len(parts) != 3 {
+			// for condition {
+			return "while (" + expression + ") {", b
+		}
+		init := strings.SplitN(parts[0], ":=", 2)
+		if name := strings.TrimSpace(init[0]); len(init) == 2 && has(captured, name) {
+			// for i := 0; i < 10; i++ {
+			// -->
+			// for (auto _r__1 = _loop_variable(0); (*_r__1) < 10; _r__1 = _loop_variable(*_r__1), (*_r__1)++) {
+			// auto& i = *_r__1;
+			variable := RangeVariable()
+			condition := replaceIdentifier(parts[1], name, "(*"+variable+")")
+			post := replaceIdentifier(parts[2], name, "(*"+variable+")")
+			if perIterationLoopVariables {
+				// The variable of the next iteration starts out with the value of the current one
+				renew := variable + " = _loop_variable(*" + variable + ")"
+				if post == "" {
+					post = renew
+				} else {
+					post = renew + ", " + post
+				}
+			}
+			b.loopVariables = []string{variable}
+			return "for (auto " + variable + " = _loop_variable(" + strings.TrimSpace(init[1]) + "); " + condition + "; " + post + ") {\nauto& " + name + " = *" + variable + ";", b
+		}
+		// for init; condition; post {
+		return "for (" + SimpleStatement(parts[0]) + "; " + parts[1] + "; " + SimpleStatement(parts[2]) + ") {", b
+	}
+	left := strings.TrimSpace(expression[:rangePos])
+	listName := strings.TrimSpace(expression[rangePos+len("range"):])
+	declare := strings.HasSuffix(left, ":=")
+	left = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(left, ":="), "="))
+	var names []string
+	if left != "" {
+		names = splitTopLevel(left, ',')
+	}
+	// Trailing blank identifiers can be ignored
+	for len(names) > 0 && names[len(names)-1] == "_" {
+		names = names[:len(names)-1]
+	}
+
+	// Existing variables are assigned to at the start of each iteration
+	assignments := ""
+	// Loop variables that are shared by all iterations are declared before the loop
+	declarations := ""
+	loopNames := make([]string, len(names))
+	for i, name := range names {
+		loopNames[i] = name
+		if name == "_" || !declare || has(captured, name) {
+			loopNames[i] = RangeVariable()
+		}
+		if name != "_" && !declare {
+			assignments += "\n" + name + " = " + loopNames[i] + ";"
+		} else if name != "_" && has(captured, name) {
+			variable := RangeVariable()
+			b.loopVariables = append(b.loopVariables, variable)
+			if perIterationLoopVariables {
+				assignments += "\nauto " + variable + " = _loop_variable(" + loopNames[i] + ");\nauto& " + name + " = *" + variable + ";"
+			} else {
+				declarations += "std::shared_ptr<void> " + variable + ";\n"
+				assignments += "\nauto& " + name + " = _shared_loop_variable(" + variable + ", " + loopNames[i] + ");"
+			}
+		}
+	}
+
+	functionName := listName
+	if pos := strings.Index(functionName, "("); pos != -1 {
+		functionName = functionName[:pos]
+	}
+	if has(iteratorFunctions, functionName) || isIterator(listName) {
+		// for k, v := range f {
+		// -->
+		// f([&](auto k, auto v, auto...) -> bool {
+		params := ""
+		for _, name := range loopNames {
+			params += "auto " + name + ", "
+		}
+		b.iterator = true
+		return declarations + listName + "([&](" + params + "auto...) -> bool {" + assignments, b
+	}
+
+	if has(encounteredHashMaps, listName) && declare && len(b.loopVariables) == 0 {
+		hashMapName := listName
+		switch {
+		case len(names) == 1:
+			// looping over the keys of a hash map
+			return "for (const auto & [" + names[0] + ", " + names[0] + "__" + "] : " + hashMapName + ") {", b
+		case len(names) == 2 && names[0] == "_":
+			// looping over the values of a hash map
+			hashMapHashKey := hashMapName + hashMapSuffix
+			return "for (const auto & " + hashMapHashKey + " : " + hashMapName + ") {" + "\n" + "auto " + names[1] + " = " + hashMapHashKey + ".second;", b
+		case len(names) == 2:
+			// for k, v := range m
+			return "for (const auto & [" + names[0] + ", " + names[1] + "] : " + hashMapName + ") {", b
+		}
+	}
+
+	switch len(loopNames) {
+	case 0:
+		// for range x {
+		return "for ([[maybe_unused]] auto " + RangeVariable() + " : _range_indices(" + listName + ")) {", b
+	case 1:
+		// for i := range x {
+		return declarations + "for (auto " + loopNames[0] + " : _range_indices(" + listName + ")) {" + assignments, b
+	}
+	// for i, v := range x {
+	return declarations + "for (auto [" + loopNames[0] + ", " + loopNames[1] + "] : _range_pairs(" + listName + ")) {" + assignments, b
+}
+
+func SwitchExpressionVariable() string {
+	return switchPrefix + strconv.Itoa(switchExpressionCounter)
+}
+
+func LabelName() string {
+	return labelPrefix + strconv.Itoa(labelCounter)
+}
+
+// NewLabel returns a new and unique label name
+func NewLabel() string {
+	label := LabelName()
+	labelCounter++
+	return label
+}
+
+// block is a for loop, a switch statement or the body of a function literal
+// that is being transformed. Keeping track of these is needed for knowing
+// what break refers to, and how the block is closed.
+type block struct {
+	depth         int              // the curly bracket depth of the contents
+	sw            *switchStatement // nil for for loops
+	label         string           // the Go label of the statement, if any
+	breakLabel    string           // the label after a for loop, if break is used with the Go label
+	continueLabel string           // the label at the end of a for loop body, if the for loop has a Go label
+	iterator      bool             // true if the for loop body is in a function that is called by an iterator function
+	loopVariables []string         // the variables that point to loop variables on the heap, for function literals to capture
+	closure       bool             // true for the body of a function literal
+	deferred      bool             // true for the body of a function literal that is deferred
+	line          int              // the index of the first line of the block in the generated lines
+	status        string           // the variable that tells which statement left the body of an iterator loop, if any
+	exits         []string         // the statements that are carried out after the iterator function returns, by status
+	declarations  string           // the variables that are declared before an iterator loop
+}
+
+// isLabel checks if the given line of Go code is a label
+func isLabel(trimmedLine string) bool {
+	if !strings.HasSuffix(trimmedLine, ":") || trimmedLine == "default:" {
+		return false
+	}
+	name := trimmedLine[:len(trimmedLine)-1]
+	for i := 0; i < len(name); i++ {
+		if !isIdentifierChar(name[i]) || (i == 0 && isDigit(name[i])) {
+			return false
+		}
+	}
+	return len(name) > 0
+}
+
+// LabeledForLoop places the body of a transformed for loop in a block of its
+// own, so that continue with a label can jump to the end of the loop body
+// without jumping past the initialization of variables in the loop body.
+func LabeledForLoop(forLoop string, b *block) string {
+	b.continueLabel = NewLabel()
+	if !strings.HasSuffix(forLoop, "{") {
+		forLoop += ";"
+	}
+	return forLoop + "\n{ // " + b.label
+}
+
+// LabeledBranch transforms break and continue statements with labels
+func LabeledBranch(trimmedLine string, blocks []*block) string {
+	fields := strings.Fields(trimmedLine)
+	keyword, label := fields[0], fields[1]
+	for i := len(blocks) - 1; i >= 0; i-- {
+		b := blocks[i]
+		if b.label != label {
+			continue
+		}
+		var code string
+		switch {
+		case keyword == "continue" && b.sw != nil:
+			panic("invalid continue label " + label + ": " + trimmedLine)
+		case keyword == "continue" && b.iterator:
+			// The loop body is a function that is called for each iteration
+			code = "return true; // " + trimmedLine
+		case keyword == "continue":
+			code = "goto " + b.continueLabel + "; // " + trimmedLine
+		case b.sw != nil:
+			code = Break(b.sw) + " " + label
+		case b.iterator:
+			code = "return false; // " + trimmedLine
+		default:
+			if b.breakLabel == "" {
+				b.breakLabel = NewLabel()
+			}
+			code = "goto " + b.breakLabel + "; // " + trimmedLine
+		}
+		return LeaveIteratorLoops(blocks, i+1, "", code)
+	}
+	panic("label " + label + " not defined or not on an enclosing for or switch statement: " + trimmedLine)
+}
+
+// iteratorLoop returns the index of the outermost for loop over an iterator
+// function that the current line is in, from the given block and within the
+// current function or function literal, or -1
+func iteratorLoop(blocks []*block, from int) int {
+	for i := from; i < len(blocks); i++ {
+		if blocks[i].closure {
+			return iteratorLoop(blocks, i+1)
+		}
+	}
+	for i := from; i < len(blocks); i++ {
+		if blocks[i].iterator {
+			return i
+		}
+	}
+	return -1
+}
+
+// LeaveIteratorLoops transforms a statement that leaves the bodies of the
+// for loops over iterator functions, from the given block and inwards. The
+// bodies are functions, so each of them stores which statement it was left
+// by and returns false, and the statement is carried out after the iterator
+// function returns. pre is the C++ code that is run in the innermost body,
+// and code is the C++ statement that is carried out after the outermost loop.
+func LeaveIteratorLoops(blocks []*block, from int, pre, code string) string {
+	for i := len(blocks) - 1; i >= from; i-- {
+		b := blocks[i]
+		if !b.iterator {
+			continue
+		}
+		if b.status == "" {
+			b.status = RangeVariable()
+		}
+		b.exits = append(b.exits, LeaveIteratorLoops(blocks[:i], from, "", code))
+		return "{ " + pre + b.status + " = " + strconv.Itoa(len(b.exits)) + "; return false; }"
+	}
+	if pre != "" {
+		return "{ " + pre + code + " }"
+	}
+	return code
+}
+
+// IteratorReturn transforms a return statement in the body of a for loop over
+// an iterator function, which is a function that is called for each iteration.
+// The results are stored, and returned after the iterator function returns.
+func IteratorReturn(trimmedLine string, blocks []*block, resultNames []string, resultLabel, returnType, functionName string) string {
+	values := strings.TrimSpace(strings.TrimPrefix(trimmedLine, "return"))
+	from := iteratorLoop(blocks, 0)
+	pre, code := "", "return;"
+	switch {
+	case inFunctionLiteral(blocks) && values != "":
+		fmt.Fprintln(os.Stderr, "returning a value from a function literal in a for loop over an iterator function is not supported: "+trimmedLine)
+		os.Exit(1)
+	case inFunctionLiteral(blocks):
+	case len(resultNames) > 0:
+		if values != "" {
+			assignment, _ := TupleAssignment(strings.Join(resultNames, ", "), values, false, nil)
+			if len(resultNames) == 1 {
+				assignment = resultNames[0] + " = " + values
+			}
+			pre = assignment + "; "
+		}
+		code = "return " + ResultValue(resultNames, returnType) + ";"
+		if resultLabel != "" {
+			code = "goto " + resultLabel + ";"
+		}
+	case functionName == "main":
+		code = "return 0;"
+	case values != "":
+		// The results are declared before the outermost loop
+		result := RangeVariable()
+		blocks[from].declarations += returnType + " " + result + " {};\n"
+		if strings.HasPrefix(returnType, tupleType) {
+			values = returnType + "{" + values + "}"
+		}
+		pre = result + " = " + values + "; "
+		code = "return " + result + ";"
+	}
+	return LeaveIteratorLoops(blocks, from, pre, code)
+}
+
+// ForLoopEnd transforms the closing bracket of a for loop. The variables that
+// are needed after a for loop over an iterator function are declared before
+// it, in the already generated lines.
+func ForLoopEnd(b *block, lines []string) string {
+	output := "}"
+	if b.iterator {
+		output = "return true;\n});"
+		if b.status != "" {
+			b.declarations += "int " + b.status + " = 0;\n"
+		}
+		lines[b.line] = b.declarations + lines[b.line]
+		for i, code := range b.exits {
+			output += "\nif (" + b.status + " == " + strconv.Itoa(i+1) + ") {\n" + code + "\n}"
+		}
+	}
+	if b.continueLabel != "" {
+		output = "}\n" + b.continueLabel + ":;\n}"
+	}
+	if b.breakLabel != "" {
+		output += "\n" + b.breakLabel + ":;"
+	}
+	return output
+}
+
+// switchStatement is the state of a switch statement that is being transformed
+type switchStatement struct {
+	expressionVariable string // empty for switch statements without an expression
+	caseCount          int
+	fallthroughLabel   string // the label of the next case, if the previous case falls through
+	breakLabel         string // the label after the switch statement, if break is used
+	defaultLine        int    // the index of the default case in the generated lines
+	defaultLabel       string // the label of the default case, if it is not the last case
+	lastCaseIsDefault  bool
+}
+
+// splitTopLevel splits the given Go code at the given separator, but not
+// within string literals, parentheses, square brackets or curly brackets.
+func splitTopLevel(source string, separator byte) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for _, t := range tokens(source) {
+		switch t.tok {
+		case token.LPAREN, token.LBRACE, token.LBRACK:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACK:
+			depth--
+		default:
+			if depth == 0 && t.end == t.pos+1 && source[t.pos] == separator {
+				parts = append(parts, strings.TrimSpace(source[start:t.pos]))
+				start = t.end
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(source[start:]))
+}
+
+// splitInit splits the expression of an if or switch statement into the
+// init statement and the expression
+func splitInit(source string) (string, string) {
+	parts := splitTopLevel(source, ';')
+	if len(parts) == 1 {
+		return "", parts[0]
+	}
+	return parts[0], strings.Join(parts[1:], "; ")
+}
+
+// matchingParenthesis returns the position of the parenthesis that closes
+// the parenthesis at the given position, or -1
+func matchingParenthesis(s string, pos int) int {
+	depth := 0
+	for i := pos; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// matchingBracket returns the position of the square bracket that closes
+// the square bracket at the given position, or -1
+func matchingBracket(s string, pos int) int {
+	depth := 0
+	for i := pos; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// SimpleStatement transforms a simple Go statement, like the init statement
+// of an if or switch statement
+func SimpleStatement(source string) string {
+	if !strings.Contains(source, ":=") {
+		if pos := strings.Index(source, "="); pos > 0 && strings.Contains(source[:pos], ",") && !strings.ContainsAny(source[pos-1:pos], "!<>+-*/%&|^") {
+			// for example: i, j = i+1, j-1
+			output, _ := TupleAssignment(source[:pos], source[pos+1:], false, nil)
+			return output
+		}
+		return source
+	}
+	fields := strings.SplitN(source, ":=", 2)
+	left := strings.TrimSpace(fields[0])
+	if strings.Contains(left, ",") {
+		output, _ := TupleAssignment(left, fields[1], true, nil)
+		return output
+	}
+	return "auto " + left + " = " + strings.TrimSpace(fields[1])
+}
+
+// TupleAssignment transforms an assignment to several variables, like
+// "a, b = b, a" or "x, err := f()". The values on the right hand side are
+// evaluated before any of the variables are assigned to, as in Go.
+// declare is true for :=, which only declares the variables that are not
+// in the given list of variables that are already declared in the same scope.
+// Returns the transformed statements and the names of the declared variables.
+func TupleAssignment(left, right string, declare bool, declared []string) (string, []string) {
+	names := splitTopLevel(strings.TrimSpace(left), ',')
+	values := splitTopLevel(strings.TrimSpace(right), ',')
+	tuple := strings.Join(values, ", ")
+	if len(values) > 1 {
+		tuple = "std::make_tuple(" + tuple + ")"
+	}
+	if !declare {
+		// Blank identifiers are ignored
+		for i, name := range names {
+			if name == "_" {
+				names[i] = "std::ignore"
+			}
+		}
+		return "std::tie(" + strings.Join(names, ", ") + ") = " + tuple, nil
+	}
+	var newNames []string
+	temporaries := false
+	blank := false
+	for _, name := range names {
+		switch {
+		case name == "_":
+			blank = true
+		case has(declared, name):
+			temporaries = true
+		default:
+			newNames = append(newNames, name)
+		}
+	}
+	// The new variables may shadow variables that are used on the right hand side
+	for _, name := range identifiers(right) {
+		if has(newNames, name) {
+			temporaries = true
+		}
+	}
+	bindings := make([]string, len(names))
+	for i, name := range names {
+		bindings[i] = name
+		if name == "_" || temporaries {
+			bindings[i] = RangeVariable()
+		}
+	}
+	output := "auto [" + strings.Join(bindings, ", ") + "] = " + tuple
+	if blank || temporaries {
+		output = "[[maybe_unused]] " + output
+	}
+	if !temporaries {
+		// for example: auto [a, b] = std::make_tuple(1, 2)
+		return output, newNames
+	}
+	// The values are placed in temporary variables first
+	for i, name := range names {
+		if name == "_" {
+			continue
+		}
+		if has(newNames, name) {
+			output += ";\nauto " + name + " = " + bindings[i]
+		} else {
+			output += ";\n" + name + " = " + bindings[i]
+		}
+	}
+	return output, newNames
+}
+
+// ParameterNames returns the names of the parameters of a transformed C++ function signature
+func ParameterNames(signature string) []string {
+	argsStart := strings.Index(signature, "(")
+	argsEnd := matchingParenthesis(signature, argsStart)
+	if argsStart == -1 || argsEnd == -1 || strings.TrimSpace(signature[argsStart+1:argsEnd]) == "" {
+		return nil
 	}
-	includeString := ""
-	for k, v := range includes {
-		if strings.Contains(output, k) {
-			newInclude := "#include <" + v + ">\n"
-			if !strings.Contains(includeString, newInclude) {
-				includeString += newInclude
-			}
+	var names []string
+	for _, arg := range splitTopLevel(signature[argsStart+1:argsEnd], ',') {
+		fields := strings.Fields(arg)
+		names = append(names, fields[len(fields)-1])
+	}
+	return names
+}
+
+// NamedResults returns the names and the C++ types of the named results of a
+// Go function signature, if the results are named
+func NamedResults(source string) ([]string, []string) {
+	argsStart := strings.Index(source, "(")
+	argsEnd := matchingParenthesis(source, argsStart)
+	results := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(source[argsEnd+1:]), "{"))
+	if !strings.HasPrefix(results, "(") {
+		return nil, nil
+	}
+	return argumentNamesAndTypes(results[1:matchingParenthesis(results, 0)])
+}
+
+// ResultValue returns the value that is returned by a function with the
+// given named results
+func ResultValue(names []string, returnType string) string {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return returnType + "{" + strings.Join(names, ", ") + "}"
+}
+
+// hasDefer checks if the given lines of Go code contain a defer statement,
+// outside of the function literals, which have defer stacks of their own
+func hasDefer(lines []string) bool {
+	code := strings.Join(lines, "\n")
+	for start := functionLiteral(code, 0); start != -1; start = functionLiteral(code, start) {
+		end := matchingCurlyBracket(code, start+strings.Index(code[start:], "{"))
+		if end == -1 {
+			end = len(code) - 1
 		}
+		code = code[:start] + code[end+1:]
 	}
-	return includeString + "\n" + output
+	for _, line := range strings.Split(code, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "defer ") {
+			return true
+		}
+	}
+	return false
 }
 
-func IfSentence(source string) (output string) {
-	output = source
-	expression := strings.TrimSpace(leftBetween(source, "if", "{"))
-	return "if (" + expression + ") {"
+// lastCall returns the position of the opening parenthesis of the function
+// call at the end of the given code, or -1
+func lastCall(code string) int {
+	if !strings.HasSuffix(code, ")") {
+		return -1
+	}
+	depth := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		switch code[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
 }
 
-func ElseIfSentence(source string) (output string) {
-	output = source
-	expression := strings.TrimSpace(leftBetween(source, "} else if", "{"))
-	return "} else if (" + expression + ") {"
+// deferredCall transforms a function call that is deferred to a lambda that
+// makes the call. The arguments and the receiver are evaluated right away,
+// but a variable is given by reference to a method with a pointer receiver,
+// so that the method is called on the variable and not on a copy of it.
+func deferredCall(call string) string {
+	pos := lastCall(call)
+	if pos == -1 {
+		return "[=]() mutable { " + call + "; }"
+	}
+	callee := call[:pos]
+	args := splitTopLevel(call[pos+1:len(call)-1], ',')
+	var captures []string
+	for i, arg := range args {
+		arg = strings.TrimSpace(arg)
+		args[i] = arg
+		if arg == "" || isNum(arg) || strings.HasPrefix(arg, "\"") {
+			continue
+		}
+		name := "_a" + strconv.Itoa(i)
+		captures = append(captures, name+" = "+arg)
+		args[i] = name
+	}
+	variables := currentVariables()
+	separator := "."
+	if strings.Contains(callee, "->") {
+		separator = "->"
+	}
+	if receiver, method, ok := strings.Cut(callee, separator); ok && isVariable(receiver, variables) {
+		goType := typeOf(&ast.Ident{Name: receiver}, nil, variables)
+		if m, ok := findMethod(goType, method); ok && m.pointer && !strings.HasPrefix(goType, "*") {
+			captures = append(captures, "_r = &"+receiver)
+			callee = "_r->" + method
+		} else if ok {
+			captures = append(captures, "_r = "+receiver)
+			callee = "_r" + separator + method
+		}
+	} else if isVariable(callee, variables) {
+		// The function value is also evaluated right away
+		captures = append(captures, "_f = "+callee)
+		callee = "_f"
+	}
+	statement := callee + "(" + strings.Join(args, ", ") + ");"
+	if strings.HasPrefix(callee, "fmt.Print") || strings.HasPrefix(callee, "print") {
+		statement, _ = PrintStatement(strings.TrimSuffix(statement, ";"))
+		if !strings.HasSuffix(statement, ";") {
+			statement += ";"
+		}
+	}
+	return "[" + strings.Join(append([]string{"="}, captures...), ", ") + "]() mutable { " + statement + " }"
 }
 
-func TypeReplace(source string) string {
-	// TODO: uintptr, complex64 and complex128
-	trimmed := strings.TrimSpace(source)
-	// For pointer types, move the star
-	if strings.HasPrefix(trimmed, "*") {
-		trimmed = trimmed[1:] + "*"
+// Defer transforms a defer statement. The function value and the arguments
+// are evaluated right away, and the call is placed on the stack of calls that
+// are made when the function returns. Returns true if the body of a function
+// literal continues on the following lines.
+func Defer(source string, openFunctionLiteral bool) (string, bool) {
+	call := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(source), "defer "))
+	if openFunctionLiteral {
+		// for example: defer func() {
+		return deferStack + ".push(std::bind(" + call, true
+	}
+	if pos := lastCall(call); pos != -1 && strings.HasPrefix(call, "std::function<") {
+		// for example: defer func() { count++ }()
+		args := strings.TrimSpace(call[pos+1 : len(call)-1])
+		if args != "" {
+			args = ", " + args
+		}
+		return deferStack + ".push(std::bind(" + call[:pos] + args + "));", false
 	}
-	switch trimmed {
-	case "string":
-		return "std::string"
-	case "float64":
-		return "double"
-	case "float32":
-		return "float"
-	case "uint64":
-		return "std::uint64_t"
-	case "uint32":
-		return "std::uint32_t"
-	case "uint16":
-		return "std::uint16_t"
-	case "uint8":
-		return "std::uint8_t"
-	case "int64":
-		return "std::int64_t"
-	case "int32":
-		return "std::int32_t"
-	case "int16":
-		return "std::int16_t"
-	case "int8":
-		return "std::int8_t"
-	case "byte":
-		return "std::uint8_t"
-	case "rune":
-		return "std::int32_t"
-	case "uint":
-		return "unsigned int"
-	default:
-		return trimmed
+	return deferStack + ".push(" + deferredCall(call) + ");", false
+}
+
+// DeferredFunctionLiteralEnd transforms the line that closes the body of a
+// function literal that is deferred, like }() or }(x, y)
+func DeferredFunctionLiteralEnd(trimmedLine string) string {
+	args := strings.TrimSpace(trimmedLine[strings.Index(trimmedLine, "(")+1 : strings.LastIndex(trimmedLine, ")")])
+	if args != "" {
+		args = ", " + args
 	}
+	return "})" + args + "));"
 }
 
-// TODO: Make sure all variations are covered:
-// * [_] for _ = range list {
-// * [_] for i := range list {
-// * [_] for i, v := range list {
-// * [_] for _, v := range list {
-// * [_] for i, _ := range list {
-// * [_] for _, _ = range list {
-// * [_] for _ = range map {
-// * [_] for k := range map {
-// * [_] for k, v := range map {
-// * [_] for _, v := range map {
-// * [_] for k, _ := range map {
-// * [_] for _, _ = range map {
-// * [_] for i := 0; i < 10; i++ {
-// * [_] for {
-// * [_] for ;; {
-// * not possible: for x := range 10 {
-func ForLoop(source string, encounteredHashMaps []string) string {
-	expression := strings.TrimSpace(leftBetween(source, "for", "{"))
-	if expression == "" {
-		// endless loop
-		return "for (;;) {"
+// Switch transforms the first line of a switch statement. The switch statement
+// is placed in a block of its own, for the scope of the init statement.
+func Switch(source string) (string, *switchStatement) {
+	output := strings.TrimSpace(strings.TrimSpace(source)[len("switch"):])
+	if strings.HasSuffix(output, "{") {
+		output = strings.TrimSpace(output[:len(output)-1])
 	}
-	// for range, with no comma
-	if strings.Count(expression, ",") == 0 && strings.Contains(expression, "range") {
-		fields := strings.Split(expression, " ")
-		varName := fields[0]
-		listName := fields[len(fields)-1]
+	init, expression := splitInit(output)
+	sw := &switchStatement{defaultLine: -1}
+	output = "{ // switch"
+	if init != "" {
+		output += "\n" + SimpleStatement(init) + ";"
+	}
+	if expression != "" {
+		switchExpressionCounter++
+		sw.expressionVariable = SwitchExpressionVariable()
+		output += "\nauto " + sw.expressionVariable + " = " + expression + "; // switch on " + expression
+	}
+	return output, sw
+}
 
-		// for i := range l {
-		// -->
-		// for (auto i = 0; i < std::size(l); i++) {
+// caseStart returns the start of a transformed case, given the condition
+func (sw *switchStatement) caseStart(condition, comment string) string {
+	output := "} else if ("
+	if sw.caseCount == 0 {
+		output = "if ("
+	}
+	sw.caseCount++
+	output += condition + ") { // " + comment
+	if sw.fallthroughLabel != "" {
+		output += "\n" + sw.fallthroughLabel + ":;"
+		sw.fallthroughLabel = ""
+	}
+	return output
+}
 
-		hashMapName := listName
-		if has(encounteredHashMaps, hashMapName) {
-			// looping over the key of a hash map, not over the index of a list
-			return "for (const auto & [" + varName + ", " + varName + "__" + "] : " + hashMapName + ") {"
-		} else if varName == "_" {
-			return "for (const auto & [" + varName + "__" + ", " + varName + "___" + "] : " + hashMapName + ") {"
+// Case transforms a case, with one or more expressions
+func Case(source string, sw *switchStatement) string {
+	s := strings.TrimSpace(strings.TrimSpace(source)[len("case"):])
+	if strings.HasSuffix(s, ":") {
+		s = strings.TrimSpace(s[:len(s)-1])
+	}
+	var conditions []string
+	for _, expression := range SplitExpressions(s) {
+		if sw.expressionVariable == "" {
+			conditions = append(conditions, "("+expression+")")
 		} else {
-			// looping over the index of a list
-			return "for (std::size_t " + varName + " = 0; " + varName + " < std::size(" + listName + "); " + varName + "++) {"
+			conditions = append(conditions, sw.expressionVariable+" == "+expression)
 		}
 	}
-	// for range, over index and element, or key and value
-	if strings.Count(expression, ",") == 1 && strings.Contains(expression, "range") && strings.Contains(expression, ":=") {
-		fields := strings.Split(expression, ":=")
-		varnames := strings.Split(fields[0], ",")
+	sw.lastCaseIsDefault = false
+	return sw.caseStart(strings.Join(conditions, " || "), "case "+s)
+}
 
-		indexvar := varnames[0]
-		elemvar := varnames[1]
+// DefaultCase transforms the default case. The default case may be placed
+// anywhere, so unless it turns out to be the last case, it is jumped to
+// at the end of the if/else chain.
+func DefaultCase(sw *switchStatement, lineIndex int) string {
+	sw.defaultLine = lineIndex
+	sw.defaultLabel = NewLabel()
+	sw.lastCaseIsDefault = true
+	return sw.caseStart("false", "default case") + "\n" + sw.defaultLabel + ":;"
+}
 
-		fields = strings.Split(expression, " ")
-		listName := fields[len(fields)-1]
-		hashMapName := listName
+// Fallthrough transforms a fallthrough statement to a jump to the next case
+func Fallthrough(sw *switchStatement) string {
+	sw.fallthroughLabel = NewLabel()
+	return "goto " + sw.fallthroughLabel + "; // fallthrough"
+}
 
-		if has(encounteredHashMaps, hashMapName) {
-			if indexvar == "_" {
-				// looping over the values of a hash map
-				hashMapHashKey := hashMapName + hashMapSuffix
-				return "for (const auto & " + hashMapHashKey + " : " + hashMapName + ") {" + "\n" + "auto " + elemvar + " = " + hashMapHashKey + ".second"
-			}
-			// for k, v := range m
-			keyvar := indexvar
-			//hashMapHashKey := keyvar + hashMapSuffix + keysSuffix
-			return "for (const auto & [" + keyvar + ", " + elemvar + "] : " + hashMapName + ") {"
-			//return "for (auto " + hashMapHashKey + " : " + hashMapName + keysSuffix + ") {" + "\n" + "auto " + keyvar + " = " + hashMapHashKey + ".second;\nauto " + elemvar + " = " + hashMapName + ".at(" + hashMapHashKey + ".first)"
-		}
-
-		if indexvar == "_" {
-			return "for (auto " + elemvar + " : " + listName + ") {"
-		}
-		return "for (std::size_t " + indexvar + " = 0; " + indexvar + " < std::size(" + listName + "); " + indexvar + "++) {" + "\n" + "auto " + elemvar + " = " + listName + "[" + indexvar + "]"
-	}
-	// not "for" + "range"
-	if strings.Contains(expression, ":=") {
-		if strings.HasPrefix(expression, "_,") && strings.Contains(expression, "range") {
-			// For each, no index
-			varname := leftBetween(expression, ",", ":")
-			fields := strings.SplitN(expression, "range ", 2)
-			listname := fields[1]
-			// C++11 and later for each loop
-			expression = "auto &" + varname + " : " + listname
-		} else {
-			expression = "auto " + strings.Replace(expression, ":=", "=", 1)
+// Break transforms a break statement within a switch statement
+func Break(sw *switchStatement) string {
+	if sw.breakLabel == "" {
+		sw.breakLabel = NewLabel()
+	}
+	return "goto " + sw.breakLabel + "; // break"
+}
+
+// SwitchEnd transforms the closing bracket of a switch statement.
+// The default case may need to be changed, in the already generated lines.
+func SwitchEnd(sw *switchStatement, lines []string) string {
+	output := ""
+	if sw.caseCount > 0 {
+		if sw.lastCaseIsDefault {
+			// The default case is the last case, so a regular else can be used
+			defaultLine := lines[sw.defaultLine]
+			defaultLine = strings.Replace(defaultLine, "} else if (false) {", "} else {", 1)
+			defaultLine = strings.Replace(defaultLine, "if (false) {", "{", 1)
+			lines[sw.defaultLine] = strings.Replace(defaultLine, "\n"+sw.defaultLabel+":;", "", 1)
+		} else if sw.defaultLabel != "" {
+			output += "} else {\ngoto " + sw.defaultLabel + "; // default case\n"
 		}
+		output += "}\n"
+	}
+	if sw.breakLabel != "" {
+		output += sw.breakLabel + ":;\n"
 	}
-	return "for (" + expression + ") {"
+	return output + "} // end of switch"
 }
 
-func SwitchExpressionVariable() string {
-	return switchPrefix + strconv.Itoa(switchExpressionCounter)
+// VarDeclarations transforms a Go var declaration, which may declare several
+// variables. Returns the C++ declarations and the names of the variables.
+func VarDeclarations(source string, packageLevel bool) (string, []string) {
+	if names, value, ok := tupleVarSpec(source); ok {
+		return TupleVarDeclaration(names, value, packageLevel), names
+	}
+	var declarations, names []string
+	for _, spec := range VarSpecs(source) {
+		declaration, name := VarDeclaration(spec)
+		if onHeap(name) {
+			declaration = HeapVariable(declaration, name)
+		} else if onStack(name) {
+			declaration = StackVariable(declaration, name)
+		} else if packageLevel {
+			declaration = PackageVariable(declaration, name)
+		}
+		declarations = append(declarations, strings.TrimSuffix(declaration, ";"))
+		names = append(names, name)
+	}
+	return strings.Join(declarations, ";\n") + ";", names
 }
 
-func LabelName() string {
-	return labelPrefix + strconv.Itoa(labelCounter)
+// tupleVarSpec returns the names and the value of a Go var declaration of
+// several variables that are given the results of a function call, like
+// var a, b = pair(). The type of the variables, if given, is left out.
+func tupleVarSpec(source string) ([]string, string, bool) {
+	left, right, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(source), "var "), "=")
+	names := splitTopLevel(left, ',')
+	if !ok || len(names) < 2 || len(splitTopLevel(right, ',')) != 1 {
+		return nil, "", false
+	}
+	for i, name := range names {
+		names[i] = strings.Fields(name)[0]
+	}
+	return names, strings.TrimSpace(right), true
 }
 
-func Switch(source string) (output string) {
-	output = strings.TrimSpace(source)[len("switch "):]
-	if strings.HasSuffix(output, "{") {
-		output = strings.TrimSpace(output[:len(output)-1])
+// TupleVarDeclaration transforms the declaration of variables that are given
+// the results of a function call, like var a, b = pair(), to the C++
+// declarations of the variables
+func TupleVarDeclaration(names []string, value string, packageLevel bool) string {
+	if packageLevel {
+		return PackageTuple(names, value)
+	}
+	escapes := false
+	for _, name := range names {
+		escapes = escapes || onHeap(name) || onStack(name)
+	}
+	if !escapes {
+		// for example: auto [a, b] = pair()
+		output, _ := TupleAssignment(strings.Join(names, ", "), value, true, nil)
+		return output + ";"
+	}
+	// The results are placed in a temporary variable first, since the
+	// variables of a structured binding can not be placed on the heap
+	tuple := RangeVariable()
+	declarations := []string{"auto " + tuple + " = " + value}
+	for i, name := range names {
+		if name == "_" {
+			continue
+		}
+		declaration := "auto " + name + " = std::get<" + strconv.Itoa(i) + ">(" + tuple + ")"
+		if onHeap(name) {
+			declaration = HeapVariable(declaration, name)
+		} else if onStack(name) {
+			declaration = StackVariable(declaration, name)
+		}
+		declarations = append(declarations, strings.TrimSuffix(declaration, ";"))
 	}
-	switchExpressionCounter++
-	firstCase = true
-	return "auto " + SwitchExpressionVariable() + " = " + output + "; // switch on " + output
+	return strings.Join(declarations, ";\n") + ";"
 }
 
-func Case(source string) (output string) {
-	output = source
-	s := leftBetween(output, " ", ":")
-	if firstCase {
-		firstCase = false
-		output = "if ("
-	} else {
-		output = "} else if ("
+// VarSpecs splits a Go var declaration with several names, like var a, b int
+// or var a, b = 1, 2, into one declaration for each name. Declarations with
+// one name are returned as they are.
+func VarSpecs(source string) []string {
+	trimmed := strings.TrimSpace(source)
+	prefix := ""
+	if strings.HasPrefix(trimmed, "var ") {
+		prefix = "var "
+	}
+	left, right, hasValues := strings.Cut(strings.TrimPrefix(trimmed, prefix), "=")
+	names := splitTopLevel(left, ',')
+	if len(names) < 2 {
+		return []string{source}
+	}
+	// The type is given after the last name
+	last := strings.Fields(names[len(names)-1])
+	if len(last) == 0 {
+		// Unrecognized
+		panic("Unrecognized var declaration: " + source)
+	}
+	goType := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(names[len(names)-1]), last[0]))
+	names[len(names)-1] = last[0]
+	var values []string
+	if hasValues {
+		values = splitTopLevel(right, ',')
+		if len(values) != len(names) {
+			// Unrecognized
+			panic("Unrecognized var declaration: " + source)
+		}
 	}
-	output += SwitchExpressionVariable() + " == " + s + ") { // case " + s
-	if switchLabel != "" {
-		output += "\n" + switchLabel + ":"
-		switchLabel = ""
+	var specs []string
+	for i, name := range names {
+		spec := prefix + strings.TrimSpace(name)
+		if goType != "" {
+			spec += " " + goType
+		}
+		if hasValues {
+			spec += " = " + strings.TrimSpace(values[i])
+		}
+		specs = append(specs, spec)
 	}
-	return output
+	return specs
 }
 
 // Return transformed line and the variable name
@@ -708,6 +2605,9 @@ func VarDeclaration(source string) (string, string) {
 		}
 		if len(fields) > 2 {
 			return TypeReplace(fields[1]) + " " + fields[0] + " " + strings.Join(fields[2:], " ") + " = " + right, fields[0]
+		} else if len(fields) == 2 && underlyingType(fields[1]) == "complex64" {
+			// The complex literals are complex128, which is only explicitly converted to complex64 in C++
+			return TypeReplace(fields[1]) + " " + fields[0] + " = static_cast<" + TypeReplace(fields[1]) + ">(" + right + ")", fields[0]
 		} else if len(fields) == 2 {
 			return TypeReplace(fields[1]) + " " + fields[0] + " = " + right, fields[0]
 		} else {
@@ -718,8 +2618,9 @@ func VarDeclaration(source string) (string, string) {
 	if fields[0] == "var" {
 		fields = fields[1:]
 	}
-	if len(fields) == 2 {
-		return TypeReplace(fields[1]) + " " + fields[0], fields[0]
+	if len(fields) >= 2 {
+		// The variable is zero valued, and the type may contain spaces, like func() int
+		return TypeReplace(strings.Join(fields[1:], " ")) + " " + fields[0] + " {};", fields[0]
 	}
 	// Unrecognized
 	panic("Unrecognized var declaration: " + source)
@@ -735,7 +2636,13 @@ func TypeDeclaration(source string) (string, bool) {
 	left := strings.TrimSpace(fields[0])
 	right := strings.TrimSpace(fields[1])
 	words := strings.Split(left, " ")
-	if len(fields) == 2 {
+	if goType := strings.TrimSpace(strings.Join(fields[1:], " ")); strings.HasPrefix(goType, "struct") && strings.HasSuffix(goType, "}") {
+		// A struct type on one line, like type P struct{ X, Y int }, has
+		// a class of its own, so that it can have methods
+		return StructClass(left, StructTypeFields(goType)), false
+	} else if len(fields) == 2 {
+		// Keep track of the underlying type, for constant expressions
+		underlyingTypes[left] = right
 		// Type alias
 		return "using " + left + " = " + TypeReplace(right), false
 	} else if len(words) == 2 {
@@ -755,35 +2662,117 @@ func TypeDeclaration(source string) (string, bool) {
 	panic("Unrecognized type declaration: " + source)
 }
 
+// ConstDeclaration transforms a constant specification, either in a const
+// block or after the const keyword. A specification without values repeats
+// the type and the values of the previous one, with the next value of iota.
 func ConstDeclaration(source string) (output string) {
-	output = source
-	fields := strings.SplitN(source, "=", 2)
-	if len(fields) == 0 {
-		panic("no fields in const declaration")
-	} else if len(fields) == 1 {
-		// This happens if there is only a constant name, with no value assigned
-		// Only simple iota incrementation is supported so far (not .. << ..)
-		iotaNumber++
-		return "const auto " + strings.TrimSpace(fields[0]) + " = " + strconv.Itoa(iotaNumber)
+	source = strings.TrimSpace(source)
+	if strings.HasPrefix(source, "const ") {
+		// Not in a const block
+		source = strings.TrimSpace(source[len("const "):])
+		StartConstBlock()
 	}
+	fields := strings.SplitN(source, "=", 2)
 	left := strings.TrimSpace(fields[0])
-	right := strings.TrimSpace(fields[1])
-	words := strings.Split(left, " ")
-	if right == "iota" {
-		iotaNumber = 0
-		right = strconv.Itoa(iotaNumber)
+	var goType, values string
+	if len(fields) == 2 {
+		values = strings.TrimSpace(fields[1])
+	} else {
+		// Repeat the previous type and expression list
+		if previousConstValues == "" {
+			panic("missing init expr for const declaration: " + source)
+		}
+		goType, values = previousConstType, previousConstValues
 	}
-	if len(words) == 1 {
-		// No type
-		return "const auto " + left + " = " + right
+	names := strings.Split(left, ",")
+	words := strings.Fields(names[len(names)-1])
+	if len(words) == 0 || len(words) > 2 {
+		// Unrecognized
+		panic("Unrecognized const expression: " + source)
 	} else if len(words) == 2 {
-		if words[0] == "const" {
-			return "const auto " + words[1] + " = " + right
+		goType = words[1]
+	}
+	names[len(names)-1] = words[0]
+	expressions := SplitExpressions(values)
+	if len(expressions) != len(names) {
+		fmt.Fprintf(os.Stderr, "error in \"%s\": %d names, but %d values\n", source, len(names), len(expressions))
+		os.Exit(1)
+	}
+	for i, name := range names {
+		if i > 0 && !hasComment(output) {
+			output += ";"
 		}
-		return "const " + TypeReplace(words[1]) + " " + words[0] + " = " + right
+		if i > 0 {
+			output += "\n"
+		}
+		output += ConstSpec(strings.TrimSpace(name), goType, expressions[i])
 	}
-	// Unrecognized
-	panic("Unrecognized const expression: " + source)
+	previousConstType, previousConstValues = goType, values
+	iotaNumber++
+	return output
+}
+
+// StartConstBlock resets iota and the implicit repetition, for a new const block
+func StartConstBlock() {
+	iotaNumber = 0
+	previousConstType = ""
+	previousConstValues = ""
+}
+
+// ConstSpec transforms a single named constant with an optional Go type.
+// The value is evaluated at compile time, with the same precision and rules
+// as in Go, if possible.
+func ConstSpec(name, goType, right string) string {
+	c, err := EvalConstant(right)
+	if name == "_" {
+		if err != nil {
+			return "// _ = " + right
+		}
+		return "// _ = " + c.value.ExactString()
+	}
+	if err == errNotConstant {
+		// Let the C++ compiler evaluate the expression
+		right = FunctionCalls(NumericLiterals(right))
+		if goType == "" {
+			return "const auto " + name + " = " + right
+		}
+		return "const " + TypeReplace(goType) + " " + name + " = " + right
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error in \"%s = %s\": %s\n", name, right, err)
+		os.Exit(1)
+	}
+	if goType == "" {
+		goType = c.goType
+	}
+	if goType == "" {
+		// Untyped constants are only converted to their default type when used,
+		// so they may be too large for any type as long as they are not used.
+		declareConstant(name, c)
+		literalType, err := untypedLiteralType(c.value)
+		if err != nil {
+			return "// const " + name + " = " + c.value.ExactString() + " (untyped " + c.value.Kind().String() + " constant)"
+		}
+		// The constant has the type that it is converted to when it is used on its own
+		return "const " + ConstantType(literalType) + " " + name + " = " + ConstantLiteral(c.value, literalType)
+	}
+	c.value, err = representable(c.value, goType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error in \"%s = %s\": %s\n", name, right, err)
+		os.Exit(1)
+	}
+	declareConstant(name, typedConstant{c.value, goType})
+	return "const " + ConstantType(goType) + " " + name + " = " + ConstantLiteral(c.value, goType)
+}
+
+// declareConstant adds a constant that is declared on the line that is being
+// transformed, either in a function or at the package level
+func declareConstant(name string, c typedConstant) {
+	if currentFunction(currentLine) != nil {
+		localConstants[variable{name, currentLine}] = c
+		return
+	}
+	constants[name] = c
 }
 
 // HashElements transforms the contents of a map in Go to the contents of an unordered_map in C++
@@ -843,6 +2832,139 @@ func CreateStrMethod(varNames []string) string {
 	return sb.String()
 }
 
+// incomparableType returns the type that makes values of the given Go type
+// impossible to compare with ==, like a slice field of a struct, or an
+// empty string if the values can be compared
+func incomparableType(goType string) string {
+	goType = underlyingType(strings.TrimSpace(goType))
+	switch {
+	case strings.HasPrefix(goType, "[]") || strings.HasPrefix(goType, "map[") || strings.HasPrefix(goType, "func"):
+		return goType
+	case strings.HasPrefix(goType, "["):
+		// An array can be compared if the elements can be compared
+		return incomparableType(goType[matchingBracket(goType, 0)+1:])
+	}
+	for _, field := range structTypes[goType] {
+		if t := incomparableType(field.goType); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// CreateComparisonMethods creates operator== for a struct, and a _hash
+// method, so that the struct can be used as a map key. As in Go, a struct
+// can not be compared if it has fields that can not be compared.
+func CreateComparisonMethods(structName string, varNames []string) string {
+	if t := incomparableType(structName); t != "" {
+		return "// invalid operation: struct containing " + t + " cannot be compared\n" +
+			"auto operator==(" + structName + " const&) const -> bool = delete;\n"
+	}
+	var sb strings.Builder
+	sb.WriteString("auto operator==(" + structName + " const&) const -> bool = default;\n")
+	sb.WriteString("auto _hash() const -> std::size_t {\n")
+	sb.WriteString("  std::size_t h = 0;\n")
+	for _, varName := range varNames {
+		sb.WriteString("  _hash_combine(h, " + varName + ");\n")
+	}
+	sb.WriteString("  return h;\n")
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// DoxygenComment transforms the lines of a Go doc comment to a Doxygen comment.
+// Also returns the message from a "Deprecated: " paragraph, if there is one.
+func DoxygenComment(docLines []string) (string, string) {
+	var sb strings.Builder
+	deprecationMessage := ""
+	inDeprecated := false
+	for i, docLine := range docLines {
+		text := strings.TrimPrefix(docLine, "//")
+		trimmedText := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmedText, "Deprecated:") {
+			inDeprecated = true
+			trimmedText = strings.TrimSpace(trimmedText[len("Deprecated:"):])
+			text = " @deprecated " + trimmedText
+			deprecationMessage = trimmedText
+		} else if trimmedText == "" {
+			inDeprecated = false
+		} else if inDeprecated {
+			deprecationMessage += " " + trimmedText
+		}
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("///" + strings.TrimRight(text, " \t"))
+	}
+	return sb.String(), deprecationMessage
+}
+
+// DoxygenGroupEnd ends a Doxygen member group
+const DoxygenGroupEnd = "///@}"
+
+// DoxygenGroupStart transforms the doc comment of a group of declarations,
+// like const ( ... ), to the start of a Doxygen member group. The first line
+// of the comment is the name of the group.
+func DoxygenGroupStart(docLines []string) string {
+	doxygen, _ := DoxygenComment(docLines)
+	return "/// @name" + strings.TrimPrefix(doxygen, "///") + "\n///@{"
+}
+
+// Deprecated adds a [[deprecated]] attribute to the given C++ declaration
+func Deprecated(declaration, message string) string {
+	attribute := "[[deprecated(" + strconv.Quote(message) + ")]]"
+	if strings.HasPrefix(declaration, "class ") {
+		return "class " + attribute + " " + declaration[len("class "):]
+	} else if strings.HasPrefix(declaration, "using ") && strings.Contains(declaration, " = ") {
+		fields := strings.SplitN(declaration, " = ", 2)
+		return fields[0] + " " + attribute + " = " + fields[1]
+	}
+	return attribute + " " + declaration
+}
+
+// currentLoop returns the innermost for loop, or nil
+func currentLoop(blocks []*block) *block {
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if blocks[i].closure {
+			// The body of a function literal can not continue an outer loop
+			return nil
+		}
+		if blocks[i].sw == nil {
+			return blocks[i]
+		}
+	}
+	return nil
+}
+
+// inFunctionLiteral checks if we are in the body of a function literal
+func inFunctionLiteral(blocks []*block) bool {
+	for _, b := range blocks {
+		if b.closure {
+			return true
+		}
+	}
+	return false
+}
+
+// loopVariables returns the variables that point to the loop variables on the
+// heap, of all the for loops we are in
+func loopVariables(blocks []*block) []string {
+	var variables []string
+	for _, b := range blocks {
+		variables = append(variables, b.loopVariables...)
+	}
+	return variables
+}
+
+// currentSwitch returns the innermost switch statement, if the innermost
+// for loop or switch statement is a switch statement
+func currentSwitch(blocks []*block) *switchStatement {
+	if len(blocks) == 0 {
+		return nil
+	}
+	return blocks[len(blocks)-1].sw
+}
+
 func go2cpp(source string) string {
 	if strings.Contains(source, "`") {
 		fmt.Fprintf(os.Stderr, "backticks in the source code are not yet supported\n")
@@ -857,21 +2979,109 @@ func go2cpp(source string) string {
 	inType := false
 	inConst := false
 	inHashMap := false
+	inBlockComment := false
+	docComment := []string{}
+	// In a group of declarations with a doc comment
+	inDocGroup := false
 	hashKeyType := ""
 	curlyCount := 0
 	// Keep track of encountered hash maps
 	// TODO: Use reflection instead to loop either one way or the other. The hash map may be defined in another package.
 	encounteredHashMaps := []string{}
+	// Keep track of functions that can be ranged over
+	iteratorFunctions := []string{}
 	// Keep track of encountered struct names
 	encounteredStructNames := []string{}
+	// The structs have _str methods, for outputting their values
+	haveStructs := false
 	inStruct := false
+	structName := ""
 	usePrettyPrint := false
-	for _, line := range strings.Split(source, "\n") {
+	// Keep track of the for loops and switch statements we are in
+	blocks := []*block{}
+	// The Go label of the next statement, if any
+	pendingLabel := ""
+	// The names of the variables that are declared in each block we are in
+	scopes := [][]string{{}}
+	// The named results of the current function, if any
+	resultNames := []string{}
+	// The label at the end of the current function, if it has both named
+	// results and deferred calls that may modify them
+	resultLabel := ""
+	sourceLines := strings.Split(source, "\n")
+	// Functions may be called before they are declared
+	variadicFunctions = map[string]variadicFunction{}
+	for _, line := range sourceLines {
+		VariadicFunction(line)
+	}
+	SelectStatements(source)
+	panics = Panics(source)
+	StructTypes(sourceLines)
+	Methods(sourceLines)
+	Functions(sourceLines)
+	Initialization(sourceLines)
+	// The number of lines that have been joined with a previous line
+	joinedLines := 0
+	// The position in the output of the current top level declaration
+	declarationStart := 0
+	for lineIndex, line := range sourceLines {
+		if joinedLines > 0 {
+			joinedLines--
+			continue
+		}
+		currentLine = lineIndex
+		scannedTokens = map[string][]lineToken{}
+		// Comments are kept as they are, since the syntax is the same in C++
+		var comment string
+		lineStartsInBlockComment := inBlockComment
+		line, comment, inBlockComment = splitComment(line, inBlockComment)
+		if !inBlockComment {
+			// A function signature or a composite literal may continue on the following lines
+			line, joinedLines = MultiLineSignature(line, sourceLines[lineIndex+1:])
+			if joinedLines == 0 {
+				line, joinedLines = MultiLineLiteral(line, sourceLines[lineIndex+1:])
+			}
+		}
+		lastLine = lineIndex + joinedLines
+		line = LocalTypes(line, lineIndex)
+		if curlyCount == 0 && !inImport && !inVar && !inType && !inConst && !inStruct {
+			declarationStart = len(lines)
+		}
+		if !inConst && !strings.HasPrefix(line, "const ") {
+			// Constant expressions are evaluated by ConstDeclaration instead
+			line = FunctionCalls(NumericLiterals(Expressions(line)))
+		}
+		// The body of a function literal may continue on the following lines
+		openFunctionLiteral := false
+		deferredFunctionLiteral := false
+		if !strings.HasPrefix(line, "func ") {
+			line = VariadicCalls(line)
+			line, openFunctionLiteral = FunctionLiterals(line, loopVariables(blocks))
+		}
 		newLine := line
-		trimmedLine := stripSingleLineComment(strings.TrimSpace(line))
-		// TODO: A multiline string could have lines starting with //, make sure to support this
-		if strings.HasPrefix(trimmedLine, "//") {
-			lines = append(lines, trimmedLine)
+		trimmedLine := line
+		if len(trimmedLine) == 0 && strings.HasPrefix(comment, "//") && !lineStartsInBlockComment {
+			// This may be a doc comment, wait and see what comes next
+			docComment = append(docComment, comment)
+			continue
+		}
+		// Doc comments directly above declarations are converted to Doxygen comments
+		isDeclaration := strings.HasPrefix(trimmedLine, "func ") || strings.HasPrefix(trimmedLine, "type ") || strings.HasPrefix(trimmedLine, "const ") || ((inType || inConst || inStruct) && trimmedLine != ")" && trimmedLine != "}")
+		deprecationMessage := ""
+		if len(docComment) > 0 && (trimmedLine == "const (" || trimmedLine == "type (") {
+			// The doc comment of a group of declarations names the group
+			lines = append(lines, DoxygenGroupStart(docComment))
+			inDocGroup = true
+		} else if len(docComment) > 0 && isDeclaration {
+			var doxygen string
+			doxygen, deprecationMessage = DoxygenComment(docComment)
+			lines = append(lines, doxygen)
+		} else {
+			lines = append(lines, docComment...)
+		}
+		docComment = []string{}
+		if len(trimmedLine) == 0 && len(comment) > 0 {
+			lines = append(lines, comment)
 			continue
 		}
 		if strings.HasSuffix(trimmedLine, ";") {
@@ -883,49 +3093,169 @@ func go2cpp(source string) string {
 		}
 		// Keep track of how deep we are into curly brackets
 		curlyCount += (strings.Count(trimmedLine, "{") - strings.Count(trimmedLine, "}"))
+		// Keep track of the variables that are declared in each block
+		if curlyCount >= 0 && len(scopes) > curlyCount+1 {
+			scopes = scopes[:curlyCount+1]
+		}
+		for len(scopes) < curlyCount+1 {
+			scopes = append(scopes, []string{})
+		}
+		if strings.HasPrefix(trimmedLine, "}") && strings.HasSuffix(trimmedLine, "{") {
+			// for example: } else {
+			scopes[len(scopes)-1] = []string{}
+		}
 		if inImport && strings.Contains(trimmedLine, ")") {
 			inImport = false
 			continue
 		} else if inImport {
 			continue
-		} else if inVar && strings.Contains(trimmedLine, ")") {
+		} else if inVar && trimmedLine == ")" {
 			inVar = false
 			continue
 		} else if inType && strings.Contains(trimmedLine, ")") {
 			inType = false
+			if inDocGroup {
+				lines = append(lines, DoxygenGroupEnd)
+				inDocGroup = false
+			}
 			continue
-		} else if inConst && strings.Contains(trimmedLine, ")") {
+		} else if inConst && trimmedLine == ")" {
 			inConst = false
+			if inDocGroup {
+				lines = append(lines, DoxygenGroupEnd)
+				inDocGroup = false
+			}
 			continue
 		} else if inHashMap && trimmedLine == "}" {
 			inHashMap = false
 			newLine = trimmedLine + ";"
-		} else if inVar || (inStruct && trimmedLine != "}") {
-			name := ""
-			newLine, name = VarDeclaration(trimmedLine)
-			if inStruct {
+		} else if inStruct && trimmedLine != "}" {
+			// The fields are zero valued, unless they are given a value
+			var declarations []string
+			for _, field := range StructFields(trimmedLine) {
+				declarations = append(declarations, TypeReplace(field.goType)+" "+field.name+" {}")
 				// Gathering variable names from this struct
-				encounteredStructNames = append(encounteredStructNames, name)
+				encounteredStructNames = append(encounteredStructNames, field.name)
 			}
+			newLine = strings.Join(declarations, ";\n") + ";"
+		} else if inVar {
+			var names []string
+			newLine, names = VarDeclarations(trimmedLine, curlyCount == 0)
+			scopes[len(scopes)-1] = append(scopes[len(scopes)-1], names...)
 		} else if inType {
 			prevInStruct := inStruct
 			newLine, inStruct = TypeDeclaration(trimmedLine)
 			if !prevInStruct && inStruct {
 				// Entering struct, reset the slice that is used to gather variable names
 				encounteredStructNames = []string{}
+				structName = strings.Fields(trimmedLine)[0]
+			} else if strings.HasPrefix(newLine, "class ") {
+				// A struct type on one line
+				haveStructs = true
 			}
 		} else if inConst {
 			newLine = ConstDeclaration(line)
 		} else if inHashMap {
 			newLine = HashElements(trimmedLine, hashKeyType, false)
 		} else if strings.HasPrefix(trimmedLine, "func") {
-			newLine, currentReturnType, currentFunctionName = FunctionSignature(trimmedLine)
-		} else if strings.HasPrefix(trimmedLine, "for") {
-			newLine = ForLoop(line, encounteredHashMaps)
-		} else if strings.HasPrefix(trimmedLine, "switch") {
-			newLine = Switch(line)
-		} else if strings.HasPrefix(trimmedLine, "case") {
-			newLine = Case(line)
+			signature, receiver := trimmedLine, ""
+			if strings.HasPrefix(trimmedLine, "func (") {
+				receiver, signature = splitReceiver(trimmedLine)
+				scopes[len(scopes)-1] = append(scopes[len(scopes)-1], strings.Fields(receiver)[0])
+			}
+			newLine, currentReturnType, currentFunctionName = FunctionSignature(signature)
+			if currentFunctionName == "init" && receiver == "" {
+				newLine = InitFunction(newLine)
+			}
+			scopes[len(scopes)-1] = append(scopes[len(scopes)-1], ParameterNames(newLine)...)
+			for _, name := range ParameterNames(newLine) {
+				if onHeap(name) {
+					// The address of the parameter is taken, so the argument is copied to the heap
+					argsStart := strings.Index(newLine, "(")
+					argsEnd := matchingParenthesis(newLine, argsStart)
+					newLine = newLine[:argsStart] + replaceIdentifier(newLine[argsStart:argsEnd], name, "_"+name) + newLine[argsEnd:]
+					newLine += "\nauto& " + name + " = *_gc_new(_" + name + ");"
+				}
+			}
+			// Named results are zero valued variables
+			var resultTypes []string
+			resultNames, resultTypes = NamedResults(signature)
+			for i, name := range resultNames {
+				newLine += "\n" + resultTypes[i] + " " + name + " {};"
+			}
+			scopes[len(scopes)-1] = append(scopes[len(scopes)-1], resultNames...)
+			resultLabel = ""
+			if hasDefer(blockLines(sourceLines, lineIndex)) {
+				if len(resultNames) > 0 {
+					// The deferred calls are made at the end of this block,
+					// before the named results are returned
+					resultLabel = NewLabel()
+					newLine += "\n{"
+				}
+				newLine += "\n_defer_stack " + deferStack + ";"
+			}
+			if receiver != "" {
+				// A method is a member function of the class for the receiver type
+				newLine = MethodSignature(newLine, receiver)
+			} else if currentFunctionName == "main" {
+				newLine = MainStart(newLine)
+			}
+			if strings.Contains(trimmedLine, "(yield func(") || strings.Contains(trimmedLine, ") iter.Seq") {
+				// Functions that can be ranged over
+				iteratorFunctions = append(iteratorFunctions, currentFunctionName)
+			}
+		} else if strings.HasPrefix(trimmedLine, "for ") || trimmedLine == "for {" {
+			var b *block
+			captured := capturedVariables(blockLines(sourceLines, lineIndex))
+			newLine, b = ForLoop(line, encounteredHashMaps, iteratorFunctions, captured)
+			b.depth, b.label, b.line = curlyCount, pendingLabel, len(lines)
+			if b.label != "" && !b.iterator {
+				newLine = LabeledForLoop(newLine, b)
+			}
+			blocks = append(blocks, b)
+		} else if strings.HasPrefix(trimmedLine, "switch ") || trimmedLine == "switch {" {
+			var sw *switchStatement
+			newLine, sw = Switch(line)
+			blocks = append(blocks, &block{depth: curlyCount, sw: sw, label: pendingLabel})
+		} else if strings.HasPrefix(trimmedLine, "case ") && currentSwitch(blocks) != nil {
+			newLine = Case(line, currentSwitch(blocks))
+		} else if trimmedLine == "default:" && currentSwitch(blocks) != nil {
+			newLine = DefaultCase(currentSwitch(blocks), len(lines))
+		} else if trimmedLine == "fallthrough" && currentSwitch(blocks) != nil {
+			newLine = Fallthrough(currentSwitch(blocks))
+		} else if trimmedLine == "break" && currentSwitch(blocks) != nil {
+			newLine = Break(currentSwitch(blocks))
+		} else if trimmedLine == "break" && len(blocks) > 0 && blocks[len(blocks)-1].iterator {
+			newLine = "return false; // break"
+		} else if trimmedLine == "continue" && currentLoop(blocks) != nil && currentLoop(blocks).iterator {
+			newLine = "return true; // continue"
+		} else if strings.HasPrefix(trimmedLine, "break ") || strings.HasPrefix(trimmedLine, "continue ") {
+			newLine = LabeledBranch(trimmedLine, blocks)
+		} else if (trimmedLine == "return" || strings.HasPrefix(trimmedLine, "return ")) && iteratorLoop(blocks, 0) != -1 {
+			newLine = IteratorReturn(trimmedLine, blocks, resultNames, resultLabel, currentReturnType, currentFunctionName)
+		} else if strings.HasPrefix(trimmedLine, "defer ") {
+			newLine, deferredFunctionLiteral = Defer(line, openFunctionLiteral)
+		} else if (trimmedLine == "return" || strings.HasPrefix(trimmedLine, "return ")) && len(resultNames) > 0 && !inFunctionLiteral(blocks) {
+			values := strings.TrimSpace(strings.TrimPrefix(trimmedLine, "return"))
+			switch {
+			case resultLabel == "" && values == "":
+				// Return the named results
+				newLine = "return " + ResultValue(resultNames, currentReturnType) + ";"
+			case resultLabel == "":
+				newLine = "return " + ResultValue(splitTopLevel(values, ','), currentReturnType) + ";"
+			case values == "":
+				// Make the deferred calls, then return the named results
+				newLine = "goto " + resultLabel + ";"
+			default:
+				assignment, _ := TupleAssignment(strings.Join(resultNames, ", "), values, false, nil)
+				if len(resultNames) == 1 {
+					assignment = resultNames[0] + " = " + values
+				}
+				newLine = "{ " + assignment + "; goto " + resultLabel + "; }"
+			}
+		} else if trimmedLine == "return" && currentFunctionName == "main" && !inFunctionLiteral(blocks) {
+			// The deferred function calls are made, and the exit status is 0
+			newLine = "return 0;"
 		} else if strings.HasPrefix(trimmedLine, "return") {
 			if strings.HasPrefix(currentReturnType, tupleType) {
 				elems := strings.SplitN(newLine, "return ", 2)
@@ -940,30 +3270,35 @@ func go2cpp(source string) string {
 			if pp {
 				usePrettyPrint = true
 			}
-		} else if strings.Contains(trimmedLine, "=") && !strings.HasPrefix(trimmedLine, "var ") && !strings.HasPrefix(trimmedLine, "if ") && !strings.HasPrefix(trimmedLine, "const ") && !strings.HasPrefix(trimmedLine, "type ") {
-			elem := strings.Split(trimmedLine, "=")
-			left := strings.TrimSpace(elem[0])
-			declarationAssignment := false
-			if strings.HasSuffix(left, ":") {
-				declarationAssignment = true
-				left = left[:len(left)-1]
-			}
-			right := strings.TrimSpace(elem[1])
+		} else if assignmentPos, assignment := assignmentOperator(trimmedLine); assignmentPos != -1 && !strings.HasPrefix(trimmedLine, "var ") && !strings.HasPrefix(trimmedLine, "if ") && !strings.HasPrefix(trimmedLine, "} else if ") && !strings.HasPrefix(trimmedLine, "const ") && !strings.HasPrefix(trimmedLine, "type ") {
+			left := strings.TrimSpace(trimmedLine[:assignmentPos])
+			declarationAssignment := assignment == ":="
+			right := strings.TrimSpace(trimmedLine[assignmentPos+len(assignment):])
 			if strings.HasPrefix(right, "&") && strings.Contains(right, "{") && strings.Contains(right, "}") {
 				right = "new " + right[1:]
 			}
-			if strings.Contains(left, ",") {
-				newLine = "auto [" + left + "] = " + right
+			if assignment != "=" && assignment != ":=" {
+				// Compound assignments, like += and <<=, are the same in C++
+				newLine = left + " " + assignment + " " + right
+			} else if len(splitTopLevel(left, ',')) > 1 {
+				// The right hand side may also contain a list of expressions
+				var names []string
+				newLine, names = TupleAssignment(left, right, declarationAssignment, scopes[len(scopes)-1])
+				scopes[len(scopes)-1] = append(scopes[len(scopes)-1], names...)
+			} else if left == "_" {
+				// The value is evaluated and then discarded
+				newLine = "static_cast<void>(" + right + ")"
 			} else if declarationAssignment {
+				scopes[len(scopes)-1] = append(scopes[len(scopes)-1], left)
 				if strings.HasPrefix(right, "[]") {
 					if !strings.Contains(right, "{") {
 						fmt.Fprintln(os.Stderr, "UNRECOGNIZED LINE: "+trimmedLine)
 						//newLine = line
 
 					}
-					theType := TypeReplace(leftBetween(right, "]", "{"))
+					theType := TypeReplace(right[:strings.Index(right, "{")])
 					fields := strings.SplitN(right, "{", 2)
-					newLine = theType + " " + strings.TrimSpace(left) + "[] {" + fields[1]
+					newLine = "auto " + strings.TrimSpace(left) + " = " + theType + "{" + fields[1]
 				} else if strings.HasPrefix(right, "map[") {
 					hashName := strings.TrimSpace(left)
 					encounteredHashMaps = append(encounteredHashMaps, hashName)
@@ -980,9 +3315,24 @@ func go2cpp(source string) string {
 						elements := leftBetween(right, "{", "}")
 						newLine = "std::unordered_map<" + keyType + ", " + valueType + "> " + hashName + " " + HashElements(elements, keyType, false)
 					}
+				} else if strings.HasPrefix(right, "std::unordered_map<") {
+					encounteredHashMaps = append(encounteredHashMaps, strings.TrimSpace(left))
+					newLine = "auto " + strings.TrimSpace(left) + " = " + right
+				} else if isStringLiteral(right) {
+					// A string variable, not a pointer to the characters of the literal
+					newLine = "std::string " + strings.TrimSpace(left) + " = " + strings.TrimSpace(right)
+				} else if currentVariables()[left] == "int" {
+					// An int in Go is 64 bits, unlike an integer literal in C++
+					newLine = TypeReplace("int") + " " + strings.TrimSpace(left) + " = " + strings.TrimSpace(right)
 				} else {
 					newLine = "auto " + strings.TrimSpace(left) + " = " + strings.TrimSpace(right)
 				}
+				if onHeap(left) {
+					// The address of the variable is taken, so it is placed on the heap
+					newLine = HeapVariable(newLine, left)
+				} else if onStack(left) {
+					newLine = StackVariable(newLine, left)
+				}
 			} else {
 				newLine = left + " = " + right
 			}
@@ -1008,49 +3358,97 @@ func go2cpp(source string) string {
 			continue
 		} else if trimmedLine == "const (" {
 			inConst = true
+			StartConstBlock()
 			continue
 		} else if strings.HasPrefix(trimmedLine, "var ") {
-			// Ignore variable name since it's not in a struct
-			newLine, _ = VarDeclaration(line)
+			var names []string
+			newLine, names = VarDeclarations(line, curlyCount == 0)
+			scopes[len(scopes)-1] = append(scopes[len(scopes)-1], names...)
 		} else if strings.HasPrefix(trimmedLine, "type ") {
 			newLine, inStruct = TypeDeclaration(trimmedLine)
+			if inStruct {
+				// Entering struct, reset the slice that is used to gather variable names
+				encounteredStructNames = []string{}
+				structName = strings.Fields(trimmedLine)[1]
+			} else if strings.HasPrefix(newLine, "class ") {
+				// A struct type on one line
+				haveStructs = true
+			}
 		} else if strings.HasPrefix(trimmedLine, "const ") {
 			newLine = ConstDeclaration(trimmedLine)
-		} else if trimmedLine == "fallthrough" {
-			newLine = "goto " + LabelName() + "; // fallthrough"
-			switchLabel = LabelName()
-			labelCounter++
-		} else if trimmedLine == "default:" {
-			newLine = "} else { // default case"
-			if switchLabel != "" {
-				newLine += "\n" + switchLabel + ":"
-				switchLabel = ""
+		}
+		// Check if for loops, switch statements or function literals are closed by this line
+		for len(blocks) > 0 && curlyCount < blocks[len(blocks)-1].depth {
+			if b := blocks[len(blocks)-1]; b.deferred {
+				newLine = DeferredFunctionLiteralEnd(trimmedLine)
+			} else if b.closure {
+				newLine = FunctionLiteralEnd(trimmedLine)
+			} else if b.sw != nil {
+				newLine = SwitchEnd(b.sw, lines)
+			} else {
+				newLine = ForLoopEnd(b, lines)
+			}
+			blocks = blocks[:len(blocks)-1]
+		}
+		if openFunctionLiteral {
+			blocks = append(blocks, &block{depth: curlyCount, closure: true, deferred: deferredFunctionLiteral})
+			if hasDefer(blockLines(sourceLines, lineIndex)) {
+				// The deferred calls in the function literal are made when it returns
+				newLine += "\n_defer_stack " + deferStack + ";"
 			}
 		}
+		// A label applies to the statement that follows it
+		if isLabel(trimmedLine) {
+			pendingLabel = trimmedLine[:len(trimmedLine)-1]
+		} else {
+			pendingLabel = ""
+		}
 		if currentFunctionName == "main" && trimmedLine == "}" && curlyCount == 0 { // curlyCount has already been decreased for this line
-			newLine = strings.Replace(trimmedLine, "}", "return 0;\n}", 1)
+			newLine = MainEnd()
+		} else if resultLabel != "" && trimmedLine == "}" && curlyCount == 0 {
+			// The deferred calls have been made when the named results are returned
+			newLine = "}\n" + resultLabel + ":;\nreturn " + ResultValue(resultNames, currentReturnType) + ";\n}"
+			resultLabel = ""
 		}
 		if strings.HasSuffix(trimmedLine, "}") {
 			// If the struct is being closed, add a semicolon
 			if inStruct {
-				// Create a _str() method for this struct
-				newLine = CreateStrMethod(encounteredStructNames) + newLine + ";"
+				// Create a _str() method for this struct, and the methods for comparing it
+				newLine = CreateStrMethod(encounteredStructNames) + CreateComparisonMethods(structName, encounteredStructNames) + MethodDeclarations(structName) + newLine + ";"
+				haveStructs = true
 
 				inStruct = false
 			}
 			newLine += "\n"
 		}
-		if (!strings.HasSuffix(newLine, ";") && !has(endings, lastchar(trimmedLine)) || strings.Contains(trimmedLine, "=")) && !strings.HasPrefix(trimmedLine, "//") && (!has(endings, lastchar(newLine)) && !strings.Contains(newLine, "//")) {
+		if !strings.HasSuffix(newLine, ";") && (!has(endings, lastchar(trimmedLine)) || strings.Contains(trimmedLine, "=") || strings.HasPrefix(trimmedLine, "return ")) && (!has(endings, lastchar(newLine)) && !hasComment(newLine)) {
 			newLine += ";"
 		}
+		if deprecationMessage != "" {
+			newLine = Deprecated(newLine, deprecationMessage)
+		}
+		if len(comment) > 0 {
+			// Place the comment after the code, but before any trailing newline
+			trimmedNewLine := strings.TrimRight(newLine, "\n")
+			newLine = trimmedNewLine + " " + comment + newLine[len(trimmedNewLine):]
+		}
+		if len(structClasses) > 0 {
+			// The anonymous struct types are declared before the declaration that uses them
+			lines = append(lines[:declarationStart], append(structClasses, lines[declarationStart:]...)...)
+			declarationStart += len(structClasses)
+			structClasses = nil
+			haveStructs = true
+		}
 		lines = append(lines, newLine)
 	}
+	lines = append(lines, docComment...)
+	lines = append(lines, PackageInitialization())
 	output := strings.Join(lines, "\n")
 
 	// The order matters
 	output = LiteralStrings(output)
 	output = WholeProgramReplace(output)
-	output = AddFunctions(output, usePrettyPrint, len(encounteredStructNames) > 0)
+	output = AddFunctions(output, usePrettyPrint, haveStructs)
 	output = AddIncludes(output)
 
 	return output
@@ -1064,24 +3462,42 @@ func main() {
 	compile := true
 	clangFormat := true
 
+	// The --gc and --explain-escapes options can be given anywhere
+	args := []string{os.Args[0]}
+	for _, arg := range os.Args[1:] {
+		switch arg {
+		case "--gc=marksweep":
+			garbageCollector = true
+		case "--gc=none":
+			garbageCollector = false
+		case "--explain-escapes":
+			explainEscapes = true
+		default:
+			args = append(args, arg)
+		}
+	}
+
 	inputFilename := ""
-	if len(os.Args) > 1 {
-		if os.Args[1] == "--help" {
+	if len(args) > 1 {
+		if args[1] == "--help" {
 			fmt.Println("supported arguments:")
 			fmt.Println(" a .go file as the first argument")
 			fmt.Println("supported options:")
 			fmt.Println(" -o : Format with clang format")
 			fmt.Println(" -O : Don't format with clang format")
+			fmt.Println(" --gc=marksweep : Collect the garbage with a mark-and-sweep collector (the default)")
+			fmt.Println(" --gc=none : Never free the memory on the heap")
+			fmt.Println(" --explain-escapes : Output which values are placed on the heap, and why, to stderr")
 			return
 		}
-		inputFilename = os.Args[1]
+		inputFilename = args[1]
 	}
-	if len(os.Args) > 2 {
-		if os.Args[2] == "-o" {
+	if len(args) > 2 {
+		if args[2] == "-o" {
 			clangFormat = true
-		} else if os.Args[2] == "-O" {
+		} else if args[2] == "-O" {
 			clangFormat = false
-		} else if os.Args[2] != "-o" {
+		} else if args[2] != "-o" {
 			log.Fatal("The second argument must be -o (format sources with clang-format) or -O (don't format sources with clang-format)")
 		}
 	}
@@ -1096,26 +3512,28 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	perIterationLoopVariables = PerIterationLoopVariables(GoVersion(inputFilename))
+	sourceFilename = inputFilename
+	if sourceFilename == "" {
+		sourceFilename = "<stdin>"
+	}
 	if debug {
 		fmt.Println(go2cpp(string(sourceData)))
 		return
 	}
 
-	cppSource := ""
+	cppSource := go2cpp(string(sourceData))
 	if clangFormat {
 		cmd := exec.Command("clang-format", "-style={BasedOnStyle: Webkit, ColumnLimit: 99}")
-		cmd.Stdin = strings.NewReader(go2cpp(string(sourceData)))
+		cmd.Stdin = strings.NewReader(cppSource)
 		var out bytes.Buffer
 		cmd.Stdout = &out
 		err = cmd.Run()
 		if err != nil {
 			log.Println("clang-format is not available, the output will look ugly!")
-			cppSource = go2cpp(string(sourceData))
 		} else {
 			cppSource = out.String()
 		}
-	} else {
-		cppSource = go2cpp(string(sourceData))
 	}
 
 	if !compile {
@@ -1123,12 +3541,19 @@ func main() {
 		return
 	}
 
-	// Compile the string in cppSource
-	cmd2 := exec.Command("g++", "-x", "c++", "-std=c++2a", "-O2", "-pipe", "-fPIC", "-Wfatal-errors", "-s", "-o", "/dev/stdout", "-")
+	// Compile the string in cppSource, to a temporary file, since the
+	// linker may not be able to write the executable to stdout
+	tempDir, err := os.MkdirTemp("", "go2cpp")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// log.Fatal does not run the deferred calls, so the directory is also
+	// removed before exiting with an error
+	defer os.RemoveAll(tempDir)
+	executable := filepath.Join(tempDir, "main")
+	cmd2 := exec.Command("g++", "-x", "c++", "-std=c++2a", "-O2", "-pipe", "-fPIC", "-Wfatal-errors", "-s", "-o", executable, "-")
 	cmd2.Stdin = strings.NewReader(cppSource)
-	var compiled bytes.Buffer
 	var errors bytes.Buffer
-	cmd2.Stdout = &compiled
 	cmd2.Stderr = &errors
 	err = cmd2.Run()
 	if err != nil {
@@ -1136,16 +3561,23 @@ func main() {
 		fmt.Println(cppSource)
 		fmt.Println("Errors:")
 		fmt.Println(errors.String())
+		os.RemoveAll(tempDir)
 		log.Fatal(err)
 	}
 	//defaultOutputFilename := filepath.Base(os.Getenv("PWD"))
 	outputFilename := ""
-	if len(os.Args) > 3 {
-		outputFilename = os.Args[3]
+	if len(args) > 3 {
+		outputFilename = args[3]
 	}
 	if outputFilename != "" {
-		err = ioutil.WriteFile(outputFilename, compiled.Bytes(), 0755)
+		compiled, err := ioutil.ReadFile(executable)
+		if err != nil {
+			os.RemoveAll(tempDir)
+			log.Fatal(err)
+		}
+		err = ioutil.WriteFile(outputFilename, compiled, 0755)
 		if err != nil {
+			os.RemoveAll(tempDir)
 			log.Fatal(err)
 		}
 	} else {
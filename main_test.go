@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -13,8 +14,51 @@ import (
 const testcaseDirectory = "testcases/"
 
 var testPrograms = []string{
+	"log_fatalf",
+	"log_fatalln",
+	"panic_assignment",
+	"var_names",
+	"index_out_of_range",
+	"negative_index",
+	"divide_by_zero",
+	"closed_channel",
+	"struct_one_line",
+	"anonymous_structs_only",
+	"function_names",
+	"channels",
+	"defer",
+	"closures",
+	"exit",
+	"panic_value",
+	"panics",
+	"log_fatal",
+	"main_return",
+	"initialization",
+	"methods",
+	"escapes",
+	"garbage_collection",
+	"pointers",
+	"anonymous_structs",
+	"arrays",
+	"struct_keys",
+	"composite_literals",
+	"variadic",
+	"named_results",
+	"operators",
+	"multiple_assignment",
+	"loop_variables",
+	"for_forms",
+	"labeled",
+	"if_init",
+	"switch_forms",
+	"complex",
+	"iota_patterns",
+	"const_expressions",
+	"numbers",
+	"doc_comments",
+	"comments",
 	"iota",
-	//"map_struct",
+	"map_struct",
 	"for_range_map_key_value",
 	"for_range_map_value",
 	"for_range_map_key",
@@ -53,6 +97,9 @@ var unorderedOutput = []string{
 	"for_range_map_key",
 }
 
+// logTimestamp is the date and time that the log package outputs before the messages
+var logTimestamp = regexp.MustCompile(`(?m)^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `)
+
 func assertEqual(t *testing.T, a interface{}, b interface{}, message string) {
 	if a == b {
 		return
@@ -96,24 +143,42 @@ func TestPrograms(t *testing.T) {
 		// Program output when running with "go run"
 		fmt.Println("[go  ] Compiling and running " + gofile + " (using go run)...")
 		stdoutGo, stderrGo, err := Run("go run " + gofile)
+		statusGo := 0
 		if err != nil {
-			t.Fatal(err)
+			// go run outputs the exit status of the program last, if it is not 0
+			statusLine := strings.LastIndex(stderrGo, "exit status ")
+			if statusLine == -1 {
+				t.Fatal(err)
+			}
+			fmt.Sscanf(stderrGo[statusLine:], "exit status %d", &statusGo)
+			stderrGo = stderrGo[:statusLine]
 		}
 
 		// Program output when compiling with go2cpp and running the executable
 		fmt.Println("[ c++] Compiling and running " + gofile + " (using go2cpp and g++)...")
 		Run("./go2cpp " + gofile + " -o " + filepath.Join(testcaseDirectory, program))
 		stdoutTgc, stderrTgc, err := Run(filepath.Join(testcaseDirectory, program))
-		if err != nil {
+		statusTgc := 0
+		exitErr, exited := err.(*exec.ExitError)
+		if exited {
+			statusTgc = exitErr.ExitCode()
+		}
+		if (err != nil && !exited) || statusTgc != statusGo {
+			// Output what went wrong before failing
 			cmd := "./go2cpp " + gofile + " -O"
 			if stdoutT, stderrT, err := Run(cmd); err != nil {
 				fmt.Println("TRANSPILATION FAILED:", cmd)
 				fmt.Println(stdoutT, stderrT)
-			} else {
+			} else if !exited {
 				t.Fatal("go2cpp should not first fail and then succeed! Something is wrong.")
+			} else {
+				fmt.Println("EXIT STATUS", statusTgc, "INSTEAD OF", statusGo, "WITH THIS OUTPUT ON STDERR:")
+				fmt.Println(stderrTgc)
 			}
 			fmt.Fprintln(os.Stderr, gofile)
-			t.Fatal(err)
+			if !exited {
+				t.Fatal(err)
+			}
 		}
 		Run("rm " + filepath.Join(testcaseDirectory, program))
 
@@ -138,7 +203,132 @@ func TestPrograms(t *testing.T) {
 		}
 
 		// Check if they are equal
+		assertEqual(t, statusGo, statusTgc, "go2cpp and go run should give the same exit status for "+gofile)
 		assertEqual(t, stdoutGo, stdoutTgc, "go2cpp and go run should produce the same output on stdout")
-		assertEqual(t, stderrGo, stderrTgc, "go2cpp and go run should produce the same output on stderr")
+		if statusGo == 0 {
+			// The panics and log.Fatal output more than the message on stderr
+			assertEqual(t, stderrGo, stderrTgc, "go2cpp and go run should produce the same output on stderr")
+		} else if statusGo == 2 {
+			// A panic outputs the value on the first line, followed by the stack traces
+			firstLineGo, _, _ := strings.Cut(stderrGo, "\n")
+			firstLineTgc, _, _ := strings.Cut(stderrTgc, "\n")
+			assertEqual(t, firstLineGo, firstLineTgc, "go2cpp and go run should output the same panic on stderr")
+		} else if statusGo == 1 {
+			// log.Fatal outputs the message, before the exit status that go run outputs.
+			// The messages are logged at different times.
+			assertEqual(t, logTimestamp.ReplaceAllString(stderrGo, "<time> "), logTimestamp.ReplaceAllString(stderrTgc, "<time> "), "go2cpp and go run should output the same error on stderr")
+		}
+	}
+}
+
+func TestNoGarbageCollector(t *testing.T) {
+	Run("go build")
+	gofile := filepath.Join(testcaseDirectory, "garbage_collection.go")
+	stdoutGo, _, err := Run("go run " + gofile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executable := filepath.Join(t.TempDir(), "garbage_collection")
+	if stdout, stderr, err := Run("./go2cpp " + gofile + " --gc=none -o " + executable); err != nil {
+		t.Fatal(stdout, stderr, err)
+	}
+	stdoutTgc, stderrTgc, err := Run(executable)
+	if err != nil {
+		t.Fatal(stderrTgc, err)
+	}
+	// The memory on the heap is never freed, so there are no collections
+	// and no frees, but the values are the same
+	lastLineGo := stdoutGo[strings.LastIndex(strings.TrimSuffix(stdoutGo, "\n"), "\n")+1:]
+	assertEqual(t, "false true false\nfalse\n"+lastLineGo, stdoutTgc, "go2cpp --gc=none should never collect the garbage, but output:\n"+stdoutTgc)
+}
+
+func TestExplainEscapes(t *testing.T) {
+	Run("go build")
+	gofile := filepath.Join(testcaseDirectory, "escapes.go")
+	_, stderr, err := Run("./go2cpp " + gofile + " --explain-escapes -O")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reasons that are given for the decisions, by the line in the Go code
+	expected := []string{
+		"moved to heap: c (captured by a closure that is returned)",
+		"&Point{...} does not escape",
+		"&Point{...} does not escape (temporary)",
+		"&Node{...} escapes to heap (stored in &Node{...})",
+		"new(int) does not escape",
+		"x does not escape",
+		"&Point{...} escapes to heap (passed to keep)",
+		"moved to heap: inner (assigned to outer, which outlives it)",
+		"moved to heap: v (appended to a slice)",
+		"count does not escape",
+	}
+	for _, message := range expected {
+		if !strings.Contains(stderr, gofile+":") || !strings.Contains(stderr, ": "+message+"\n") {
+			t.Errorf("--explain-escapes should report %q, but the output is:\n%s", message, stderr)
+		}
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	Run("go build")
+	gofile := filepath.Join(testcaseDirectory, "doc_comments.go")
+	stdout, _, err := Run("./go2cpp " + gofile + " -O")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The doc comments of groups of declarations are not a part of the first doc comment in the group
+	expected := []string{
+		"/// Answer is the answer\nconst std::int64_t Answer = 42;",
+		"/// @name Weekdays\n///@{\n/// Monday is the first day of the week\n",
+		"/// Tuesday is the second day of the week\nconst auto Tuesday = \"Tuesday\";\n///@}",
+		"/// @name Temperatures\n///@{\n/// Celsius is degrees Celsius\n",
+	}
+	for _, code := range expected {
+		if !strings.Contains(stdout, code) {
+			t.Errorf("the C++ code should contain %q, but it is:\n%s", code, stdout)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	Run("go build")
+	// Programs that go2cpp can not transform, and the error messages it should give
+	programs := []struct {
+		name, source, message string
+	}{
+		{
+			"unknown_initialization_type",
+			"package main\n\nimport \"strings\"\n\nvar s = strings.ToUpper(pad)\n\nvar pad = \"x\"\n\nfunc main() {\n\tprintln(s)\n}\n",
+			"unknown_initialization_type.go:5:5: the type of s must be given, since it is initialized after a variable that is declared later",
+		},
+		{
+			"incomparable_map_key",
+			"package main\n\ntype Tagged struct {\n\tName string\n\tTags []string\n}\n\nfunc main() {\n\tm := map[Tagged]int{}\n\tprintln(len(m))\n}\n",
+			"incomparable_map_key.go:9:11: invalid map key type Tagged",
+		},
+		{
+			"labeled_select",
+			"package main\n\nfunc main() {\n\tch := make(chan int, 1)\n\tch <- 1\nSel:\n\tselect {\n\tcase v := <-ch:\n\t\tprintln(v)\n\t\tbreak Sel\n\t}\n}\n",
+			"labeled_select.go:7:2: select statements are not supported",
+		},
+		{
+			"overflowing_constant",
+			"package main\n\nconst Big = 1 << 100\n\nfunc main() {\n\tvar x int64 = Big\n\tprintln(x)\n}\n",
+			"cannot use Big (untyped int constant 1267650600228229401496703205376) as int64 value in variable declaration (overflows)",
+		},
+	}
+	dir := t.TempDir()
+	for _, program := range programs {
+		gofile := filepath.Join(dir, program.name+".go")
+		if err := os.WriteFile(gofile, []byte(program.source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, stderr, err := Run("./go2cpp " + gofile + " -O")
+		if err == nil {
+			t.Errorf("go2cpp should fail for %s", program.name)
+		}
+		if !strings.Contains(stderr, program.message) {
+			t.Errorf("go2cpp should report %q for %s, but the output is:\n%s", program.message, program.name, stderr)
+		}
 	}
 }
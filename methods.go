@@ -0,0 +1,226 @@
+package main
+
+// Methods: member functions of the classes for the struct types, method values and method expressions
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// method is a method of a struct type
+type method struct {
+	name        string
+	pointer     bool   // the receiver is a pointer
+	params      string // the Go types of the parameters, like "int, string"
+	results     string // the Go result types, like " int" or " (int, error)"
+	declaration string // the C++ declaration of the member function
+}
+
+// The methods of the struct types in the source code, by type name
+var methods = map[string][]method{}
+
+// fieldTypes returns the Go types of the fields in a parameter or result
+// list, with the type repeated for each name
+func fieldTypes(fields *ast.FieldList, text func(ast.Node) string) []string {
+	var result []string
+	if fields == nil {
+		return nil
+	}
+	for _, field := range fields.List {
+		for range max(len(field.Names), 1) {
+			result = append(result, text(field.Type))
+		}
+	}
+	return result
+}
+
+// Methods finds the methods that are declared in the given lines of Go
+// code, so that they can be declared in the classes for the receiver types
+func Methods(lines []string) {
+	methods = map[string][]method{}
+	source := strings.Join(lines, "\n")
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, 0)
+	if err != nil {
+		return
+	}
+	text := func(n ast.Node) string {
+		return strings.Join(strings.Fields(source[fset.Position(n.Pos()).Offset:fset.Position(n.End()).Offset]), " ")
+	}
+	for _, decl := range file.Decls {
+		d, ok := decl.(*ast.FuncDecl)
+		if !ok || d.Recv == nil || len(d.Recv.List) != 1 {
+			continue
+		}
+		recvType := text(d.Recv.List[0].Type)
+		m := method{
+			name:    d.Name.Name,
+			pointer: strings.HasPrefix(recvType, "*"),
+			params:  strings.Join(fieldTypes(d.Type.Params, text), ", "),
+		}
+		if results := fieldTypes(d.Type.Results, text); len(results) == 1 {
+			m.results = " " + results[0]
+		} else if len(results) > 1 {
+			m.results = " (" + strings.Join(results, ", ") + ")"
+		}
+		// The signature is given on one line, with the names of the parameters
+		var params, results []string
+		for _, field := range d.Type.Params.List {
+			params = append(params, text(field))
+		}
+		signature := "func " + m.name + "(" + strings.Join(params, ", ") + ")"
+		if d.Type.Results != nil {
+			for _, field := range d.Type.Results.List {
+				results = append(results, text(field))
+			}
+			if len(d.Type.Results.List[0].Names) > 0 || len(results) > 1 {
+				signature += " (" + strings.Join(results, ", ") + ")"
+			} else {
+				signature += " " + results[0]
+			}
+		}
+		declaration, _, _ := FunctionSignature(signature + " {")
+		declaration = strings.TrimSuffix(declaration, " {")
+		if !m.pointer {
+			declaration = constMethod(declaration)
+		}
+		m.declaration = declaration + ";"
+		typeName := strings.TrimPrefix(recvType, "*")
+		methods[typeName] = append(methods[typeName], m)
+	}
+}
+
+// constMethod adds const to a C++ member function signature, since a
+// method with a value receiver can not modify the object
+func constMethod(signature string) string {
+	argsEnd := matchingParenthesis(signature, strings.Index(signature, "("))
+	return signature[:argsEnd+1] + " const" + signature[argsEnd+1:]
+}
+
+// findMethod returns the method with the given name of the given Go type,
+// or of the type that it points to
+func findMethod(goType, name string) (method, bool) {
+	for _, m := range methods[strings.TrimPrefix(goType, "*")] {
+		if m.name == name {
+			return m, true
+		}
+	}
+	return method{}, false
+}
+
+// MethodDeclarations returns the C++ declarations of the member functions
+// for the methods of the given struct type
+func MethodDeclarations(structName string) string {
+	var sb strings.Builder
+	for _, m := range methods[structName] {
+		sb.WriteString(m.declaration + "\n")
+	}
+	return sb.String()
+}
+
+// splitReceiver returns the receiver of a Go method declaration, like
+// "c *Counter", and the declaration as a function declaration without it
+func splitReceiver(source string) (string, string) {
+	recvStart := strings.Index(source, "(")
+	recvEnd := matchingParenthesis(source, recvStart)
+	return strings.TrimSpace(source[recvStart+1 : recvEnd]), "func " + strings.TrimSpace(source[recvEnd+1:])
+}
+
+// MethodSignature transforms the C++ function signature of a method to the
+// definition of the member function of the class for the receiver type. The
+// receiver is a pointer to the object or, for a value receiver, a copy of it.
+func MethodSignature(signature, receiver string) string {
+	fields := strings.Fields(receiver)
+	recvType := fields[len(fields)-1]
+	typeName := strings.TrimPrefix(recvType, "*")
+	if _, ok := structTypes[typeName]; !ok {
+		panic("Methods are only supported for struct types: " + recvType)
+	}
+	first, rest, _ := strings.Cut(signature, "\n")
+	first = strings.Replace(first, "auto ", "auto "+typeName+"::", 1)
+	pointer := strings.HasPrefix(recvType, "*")
+	if !pointer {
+		first = constMethod(first)
+	}
+	if len(fields) == 2 && fields[0] != "_" {
+		if pointer {
+			first += "\n" + typeName + "* " + fields[0] + " = this;"
+		} else {
+			first += "\n" + typeName + " " + fields[0] + " = *this;"
+		}
+	}
+	if rest != "" {
+		return first + "\n" + rest
+	}
+	return first
+}
+
+// isVariable checks if the given name is a local or a package level variable
+func isVariable(name string, variables map[string]string) bool {
+	_, local := variables[name]
+	_, global := globalVariables[name]
+	return local || global
+}
+
+// methodValues transforms the method values in a line of Go code, like
+// c.Add, to function values that call the method with the receiver that
+// c has when the method value is evaluated. The method expressions, like
+// Counter.Get and (*Counter).Add, are transformed to function values that
+// take the receiver as the first argument.
+func (e *lineEditor) methodValues(root ast.Node) {
+	variables := currentVariables()
+	called := map[ast.Node]bool{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			called[call.Fun] = true
+		}
+		x, ok := n.(*ast.SelectorExpr)
+		if !ok || called[x] || !e.inLine(x) {
+			return true
+		}
+		// A method expression has a type instead of a receiver
+		typeName := ""
+		if id, ok := x.X.(*ast.Ident); ok && !isVariable(id.Name, variables) {
+			typeName = id.Name
+		} else if paren, ok := x.X.(*ast.ParenExpr); ok {
+			if star, ok := paren.X.(*ast.StarExpr); ok {
+				typeName = "*" + e.text(star.X)
+			}
+		}
+		if m, ok := findMethod(typeName, x.Sel.Name); ok && typeName != "" {
+			params := typeName
+			if m.params != "" {
+				params += ", " + m.params
+			}
+			call := "_r." + m.name
+			if strings.HasPrefix(typeName, "*") {
+				call = "_r->" + m.name
+			}
+			e.replace(x, "("+TypeReplace("func("+params+")"+m.results)+"([]("+TypeReplace(typeName)+" _r, auto... _args) { return "+call+"(_args...); }))")
+			return false
+		}
+		goType := typeOf(x.X, e.text, variables)
+		m, ok := findMethod(goType, x.Sel.Name)
+		if !ok {
+			return true
+		}
+		receiver := e.renderNode(x.X)
+		// The dereferencing of the receiver is a part of the method value
+		e.render(e.offset(x.X.End()), e.offset(x.End()))
+		pointer := strings.HasPrefix(goType, "*")
+		switch {
+		case m.pointer && !pointer:
+			receiver = "&" + receiver
+		case !m.pointer && pointer:
+			receiver = "*" + receiver
+		}
+		call := "_r." + m.name
+		if m.pointer {
+			call = "_r->" + m.name
+		}
+		e.replace(x, "("+TypeReplace("func("+m.params+")"+m.results)+"([_r = "+receiver+"](auto... _args) { return "+call+"(_args...); }))")
+		return false
+	})
+}
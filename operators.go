@@ -0,0 +1,134 @@
+package main
+
+// Translation of the Go operators that have no C++ equivalent, or a different precedence
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+)
+
+// operatorEdits returns the edits that transform the Go operators in a line
+// of Go code that differ from the C++ operators:
+// * x &^ y is transformed to x & ~y
+// * x &^= y is transformed to x &= ~(y)
+// * ^x is transformed to _complement(x), which has the same type as x
+// * binary expressions with &, |, ^, << and >> are placed in parentheses
+// * the divisor y of x / y, x % y, x /= y and x %= y is transformed to _divisor(y)
+// The parentheses are needed since these operators have a higher precedence
+// than comparisons in Go. _divisor panics if an integer is divided by zero.
+// The <- operator is transformed by channelEdits.
+func operatorEdits(file *ast.File, offset func(token.Pos) int) []edit {
+	var edits []edit
+	insert := func(pos token.Pos, text string) {
+		edits = append(edits, edit{offset(pos), offset(pos), text})
+	}
+	divisor := func(y ast.Expr) {
+		// Dividing by a literal zero is a compile error in Go
+		if _, ok := ast.Unparen(y).(*ast.BasicLit); !ok {
+			insert(y.Pos(), "_divisor(")
+			insert(y.End(), ")")
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.BinaryExpr:
+			switch e.Op {
+			case token.AND_NOT:
+				edits = append(edits, edit{offset(e.OpPos), offset(e.OpPos) + len("&^"), "& ~"})
+				fallthrough
+			case token.AND, token.OR, token.XOR, token.SHL, token.SHR:
+				insert(e.Pos(), "(")
+				insert(e.End(), ")")
+			case token.QUO, token.REM:
+				divisor(e.Y)
+			}
+		case *ast.UnaryExpr:
+			switch e.Op {
+			case token.XOR:
+				edits = append(edits, edit{offset(e.OpPos), offset(e.OpPos) + len("^"), "_complement("})
+				insert(e.End(), ")")
+			}
+		case *ast.AssignStmt:
+			if e.Tok == token.AND_NOT_ASSIGN {
+				edits = append(edits, edit{offset(e.TokPos), offset(e.TokPos) + len("&^="), "&= ~("})
+				insert(e.End(), ")")
+			}
+			if (e.Tok == token.QUO_ASSIGN || e.Tok == token.REM_ASSIGN) && len(e.Rhs) == 1 {
+				divisor(e.Rhs[0])
+			}
+		}
+		return true
+	})
+	return edits
+}
+
+// smallIntegers are the Go integer types that are smaller than int
+var smallIntegers = map[string]bool{"int8": true, "int16": true, "int32": true, "rune": true, "uint8": true, "byte": true, "uint16": true, "uint32": true}
+
+// untypedOperands transforms the arithmetic in a line of Go code where an
+// untyped constant takes the type of the other operand. The integer literals
+// are 64 bits in C++, and C++ also promotes the integers that are smaller than
+// int, so the results of x op y and -x on integers that are smaller than 64
+// bits are converted to their type, which wraps around on overflow as in Go.
+// An untyped float constant is converted to float32 for a float32 operand.
+func (e *lineEditor) untypedOperands(root ast.Node) {
+	variables := currentVariables()
+	ast.Inspect(root, func(n ast.Node) bool {
+		if x, ok := n.(*ast.UnaryExpr); ok && x.Op == token.SUB && e.inLine(x) {
+			// -x is also promoted
+			if goType := typeOf(x.X, e.text, variables); smallIntegers[underlyingType(goType)] {
+				e.edits = append(e.edits, edit{e.offset(x.Pos()), e.offset(x.Pos()), TypeReplace(goType) + "("}, edit{e.offset(x.End()), e.offset(x.End()), ")"})
+			}
+			return true
+		}
+		x, ok := n.(*ast.BinaryExpr)
+		if !ok || !e.inLine(x) {
+			return true
+		}
+		switch x.Op {
+		case token.ADD, token.SUB, token.MUL, token.QUO, token.REM, token.AND, token.OR, token.XOR, token.SHL, token.SHR, token.AND_NOT:
+		default:
+			return true
+		}
+		goType := typeOf(x, e.text, variables)
+		switch t := underlyingType(goType); {
+		case smallIntegers[t]:
+			e.edits = append(e.edits, edit{e.offset(x.Pos()), e.offset(x.Pos()), TypeReplace(goType) + "("}, edit{e.offset(x.End()), e.offset(x.End()), ")"})
+		case t == "float32" && x.Op != token.SHL && x.Op != token.SHR:
+			for _, operand := range []ast.Expr{x.X, x.Y} {
+				if lit, ok := ast.Unparen(operand).(*ast.BasicLit); ok && lit.Kind == token.FLOAT {
+					e.edits = append(e.edits, edit{e.offset(lit.Pos()), e.offset(lit.Pos()), TypeReplace(goType) + "("}, edit{e.offset(lit.End()), e.offset(lit.End()), ")"})
+				}
+			}
+		}
+		return true
+	})
+}
+
+// assignmentOperator returns the position and the operator of the assignment
+// in a line of code, like =, := or <<=, or -1 and an empty string.
+// Comparisons like == and <= are not assignments.
+func assignmentOperator(line string) (int, string) {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(line))
+	s.Init(file, []byte(line), func(token.Position, string) {}, 0)
+	depth := 0
+	for {
+		pos, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return -1, ""
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.ASSIGN, token.DEFINE, token.ADD_ASSIGN, token.SUB_ASSIGN, token.MUL_ASSIGN, token.QUO_ASSIGN, token.REM_ASSIGN,
+			token.AND_ASSIGN, token.OR_ASSIGN, token.XOR_ASSIGN, token.SHL_ASSIGN, token.SHR_ASSIGN, token.AND_NOT_ASSIGN:
+			if depth == 0 {
+				return file.Offset(pos), tok.String()
+			}
+		}
+	}
+}
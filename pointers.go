@@ -0,0 +1,484 @@
+package main
+
+// Pointer semantics: the types of variables, automatic dereferencing and variables that have their address taken
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// function is the information about a function body that is gathered before
+// the function is transformed
+type function struct {
+	first, last  int           // the lines of the function body
+	declarations []declaration // the local variables, in the order of their declarations
+}
+
+// declaration is a local variable with its Go type, and the lines of the
+// block, statement or function that it is declared in
+type declaration struct {
+	name, goType string
+	line         int // the line that the variable is declared on
+	first, last  int // the lines of the scope of the variable
+}
+
+// variables returns the Go types of the local variables that are in scope on
+// the given line, by name. An inner variable shadows an outer one.
+func (f *function) variables(line int) map[string]string {
+	variables := map[string]string{}
+	for _, d := range f.declarations {
+		if d.line <= line && d.first <= line && line <= d.last {
+			variables[d.name] = d.goType
+		}
+	}
+	return variables
+}
+
+var (
+	// The functions in the source code
+	functions []*function
+
+	// The Go types of the package level variables, by name
+	globalVariables = map[string]string{}
+
+	// The Go result types of the functions with a single result, by name
+	functionResults = map[string]string{}
+
+	// The Go result types of the functions with several results, by name
+	functionTupleResults = map[string][]string{}
+
+	// The Go result types of the built-in functions and the functions in the
+	// standard library that are supported, by name
+	packageResults = map[string]string{
+		"len":               "int",
+		"cap":               "int",
+		"strings.Contains":  "bool",
+		"strings.HasPrefix": "bool",
+		"strings.TrimSpace": "string",
+	}
+)
+
+// typeOf returns the Go type of a Go expression, or an empty string if the
+// type is not known. The names of the variables are looked up in the given
+// map and then in globalVariables.
+func typeOf(expr ast.Expr, text func(ast.Node) string, variables map[string]string) string {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		if t, ok := variables[x.Name]; ok {
+			return t
+		}
+		return globalVariables[x.Name]
+	case *ast.ParenExpr:
+		return typeOf(x.X, text, variables)
+	case *ast.StarExpr:
+		return strings.TrimPrefix(typeOf(x.X, text, variables), "*")
+	case *ast.UnaryExpr:
+		t := typeOf(x.X, text, variables)
+		switch {
+		case x.Op == token.AND && t != "":
+			return "*" + t
+		case x.Op == token.ARROW:
+			// The element type of a channel that is received from
+			for _, prefix := range []string{"chan ", "<-chan "} {
+				if element, ok := strings.CutPrefix(underlyingType(t), prefix); ok {
+					return strings.TrimSpace(element)
+				}
+			}
+		}
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ, token.LAND, token.LOR:
+			return "bool"
+		case token.SHL, token.SHR:
+			return typeOf(x.X, text, variables)
+		}
+		// An untyped constant has the type of the other operand
+		left, right := typeOf(x.X, text, variables), typeOf(x.Y, text, variables)
+		_, untypedLeft := x.X.(*ast.BasicLit)
+		_, untypedRight := x.Y.(*ast.BasicLit)
+		if untypedLeft && (!untypedRight || left == "int") {
+			return right
+		} else if left == "" && right == "string" {
+			// Only strings can be added to a string literal
+			return right
+		}
+		return left
+	case *ast.BasicLit:
+		return map[token.Token]string{token.INT: "int", token.FLOAT: "float64", token.IMAG: "complex128", token.CHAR: "rune", token.STRING: "string"}[x.Kind]
+	case *ast.CompositeLit:
+		if x.Type != nil {
+			return text(x.Type)
+		}
+	case *ast.SelectorExpr:
+		t := strings.TrimPrefix(typeOf(x.X, text, variables), "*")
+		fields, ok := structTypes[t]
+		if !ok {
+			fields = structTypes[underlyingType(t)]
+		}
+		for _, field := range fields {
+			if field.name == x.Sel.Name {
+				return field.goType
+			}
+		}
+		if m, ok := findMethod(t, x.Sel.Name); ok {
+			// A method value
+			return "func(" + m.params + ")" + m.results
+		}
+	case *ast.IndexExpr:
+		t := underlyingType(typeOf(x.X, text, variables))
+		if strings.HasPrefix(t, "map[") {
+			return t[matchingBracket(t, len("map"))+1:]
+		} else if strings.HasPrefix(t, "[") {
+			return t[matchingBracket(t, 0)+1:]
+		}
+	case *ast.CallExpr:
+		if fun, ok := x.Fun.(*ast.Ident); ok && fun.Name == "new" && len(x.Args) == 1 {
+			return "*" + text(x.Args[0])
+		} else if ok && fun.Name == "make" && fun.Obj == nil && len(x.Args) > 0 {
+			return text(x.Args[0])
+		} else if ok && fun.Obj == nil && functionResults[fun.Name] == "" {
+			return packageResults[fun.Name]
+		} else if ok {
+			return functionResults[fun.Name]
+		} else if paren, ok := x.Fun.(*ast.ParenExpr); ok {
+			// A conversion, like (*T)(nil)
+			return text(paren.X)
+		} else if sel, ok := x.Fun.(*ast.SelectorExpr); ok {
+			if m, ok := findMethod(typeOf(sel.X, text, variables), sel.Sel.Name); ok && !strings.HasPrefix(m.results, " (") {
+				return strings.TrimSpace(m.results)
+			} else if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Obj == nil {
+				return packageResults[pkg.Name+"."+sel.Sel.Name]
+			}
+		}
+	}
+	return ""
+}
+
+// elementTypes returns the Go types of the key and the value when ranging
+// over a value of the given Go type
+func elementTypes(goType string) (string, string) {
+	t := underlyingType(goType)
+	switch {
+	case t == "string":
+		return "int", "rune"
+	case strings.HasPrefix(t, "map["):
+		keyEnd := matchingBracket(t, len("map"))
+		return t[len("map["):keyEnd], t[keyEnd+1:]
+	case strings.HasPrefix(t, "["):
+		return "int", t[matchingBracket(t, 0)+1:]
+	}
+	return "", ""
+}
+
+// Functions gathers the types of the variables in the functions in the given
+// lines of Go code, and which of the values must be placed on the heap
+func Functions(lines []string) {
+	functions = nil
+	globalVariables = map[string]string{}
+	functionResults = map[string]string{}
+	functionTupleResults = map[string][]string{}
+	allocations = nil
+	heapVariables = map[variable]bool{}
+	stackPointers = map[variable]bool{}
+	// The lines are parsed as they are, so that the positions are the positions in the Go code
+	source := strings.Join(lines, "\n")
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, 0)
+	if err != nil {
+		return
+	}
+	text := func(n ast.Node) string {
+		return source[fset.Position(n.Pos()).Offset:fset.Position(n.End()).Offset]
+	}
+	for _, decl := range file.Decls {
+		d, ok := decl.(*ast.FuncDecl)
+		if !ok || d.Type.Results == nil {
+			continue
+		}
+		if len(d.Type.Results.List) == 1 && len(d.Type.Results.List[0].Names) <= 1 {
+			functionResults[d.Name.Name] = text(d.Type.Results.List[0].Type)
+			continue
+		}
+		if d.Recv != nil {
+			continue
+		}
+		for _, field := range d.Type.Results.List {
+			for range max(len(field.Names), 1) {
+				functionTupleResults[d.Name.Name] = append(functionTupleResults[d.Name.Name], text(field.Type))
+			}
+		}
+	}
+	// The package level variables may be used before they are declared
+	for range 2 {
+		for _, decl := range file.Decls {
+			if d, ok := decl.(*ast.GenDecl); ok {
+				valueSpecs(d, text, globalVariables)
+			}
+		}
+	}
+	bodies := map[*ast.FuncDecl]*function{}
+	for _, decl := range file.Decls {
+		d, ok := decl.(*ast.FuncDecl)
+		if !ok || d.Body == nil {
+			continue
+		}
+		f := &function{
+			first: fset.Position(d.Pos()).Line - 1,
+			last:  fset.Position(d.Body.Rbrace).Line - 1,
+		}
+		line := func(n ast.Node) int {
+			return fset.Position(n.Pos()).Line - 1
+		}
+		// The types that are declared in the function have unique names
+		localText := func(n ast.Node) string {
+			return LocalTypes(text(n), line(n))
+		}
+		// The nodes that the current node is in, for finding the scope of a variable
+		var stack []ast.Node
+		declare := func(id *ast.Ident, goType string) {
+			var scope ast.Node = d
+			for i := len(stack) - 1; i >= 0; i-- {
+				switch stack[i].(type) {
+				case *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.CaseClause, *ast.CommClause, *ast.FuncLit:
+					scope = stack[i]
+				default:
+					continue
+				}
+				break
+			}
+			f.declarations = append(f.declarations, declaration{id.Name, goType, line(id), line(scope), fset.Position(scope.End()).Line - 1})
+		}
+		ast.Inspect(d, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			stack = append(stack, n)
+			switch x := n.(type) {
+			case *ast.FuncDecl:
+				if x.Recv != nil {
+					for _, field := range x.Recv.List {
+						for _, name := range field.Names {
+							declare(name, localText(field.Type))
+						}
+					}
+				}
+			case *ast.FuncType:
+				// Only the parameters and the results of a function have names that are in scope
+				switch stack[len(stack)-2].(type) {
+				case *ast.FuncDecl, *ast.FuncLit:
+				default:
+					return true
+				}
+				for _, fields := range []*ast.FieldList{x.Params, x.Results} {
+					if fields == nil {
+						continue
+					}
+					for _, field := range fields.List {
+						for _, name := range field.Names {
+							declare(name, localText(field.Type))
+						}
+					}
+				}
+			case *ast.ValueSpec:
+				variables := f.variables(line(x))
+				for i, name := range x.Names {
+					declare(name, specType(x, i, localText, variables))
+				}
+			case *ast.AssignStmt:
+				if x.Tok != token.DEFINE {
+					break
+				}
+				variables := f.variables(line(x))
+				for i, left := range x.Lhs {
+					id := left.(*ast.Ident)
+					if len(x.Lhs) == len(x.Rhs) {
+						// The type is an empty string if it is not known
+						declare(id, typeOf(x.Rhs[i], localText, variables))
+					} else if id.Obj != nil && id.Obj.Decl == x {
+						// Variables that are declared before are assigned to
+						declare(id, tupleResult(x.Rhs[0], i))
+					}
+				}
+			case *ast.RangeStmt:
+				if x.Tok == token.DEFINE {
+					keyType, valueType := elementTypes(typeOf(x.X, localText, f.variables(line(x))))
+					if key, ok := x.Key.(*ast.Ident); ok && keyType != "" {
+						declare(key, keyType)
+					}
+					if value, ok := x.Value.(*ast.Ident); ok && valueType != "" {
+						declare(value, valueType)
+					}
+				}
+			}
+			return true
+		})
+		functions = append(functions, f)
+		bodies[d] = f
+	}
+	Escapes(file, fset, func(n ast.Node) string {
+		return LocalTypes(text(n), fset.Position(n.Pos()).Line-1)
+	}, bodies)
+}
+
+// valueSpecs adds the types of the variables that are declared in a Go
+// var declaration to the given map
+func valueSpecs(decl *ast.GenDecl, text func(ast.Node) string, variables map[string]string) {
+	if decl.Tok != token.VAR {
+		return
+	}
+	for _, spec := range decl.Specs {
+		vs := spec.(*ast.ValueSpec)
+		for i, name := range vs.Names {
+			variables[name.Name] = specType(vs, i, text, variables)
+		}
+	}
+}
+
+// specType returns the Go type of the variable with the given index in a Go
+// var declaration, or an empty string if it is not known
+func specType(vs *ast.ValueSpec, i int, text func(ast.Node) string, variables map[string]string) string {
+	if vs.Type != nil {
+		return text(vs.Type)
+	} else if len(vs.Values) == len(vs.Names) {
+		return typeOf(vs.Values[i], text, variables)
+	} else if len(vs.Values) == 1 {
+		return tupleResult(vs.Values[0], i)
+	}
+	return ""
+}
+
+// tupleResult returns the Go type of the result with the given index of a
+// call to a function with several results, or an empty string if it is not known
+func tupleResult(expr ast.Expr, i int) string {
+	call, ok := ast.Unparen(expr).(*ast.CallExpr)
+	if !ok {
+		return ""
+	}
+	fun, ok := call.Fun.(*ast.Ident)
+	if !ok || i >= len(functionTupleResults[fun.Name]) {
+		return ""
+	}
+	return functionTupleResults[fun.Name][i]
+}
+
+// currentFunction returns the function that the given line is in, or nil
+func currentFunction(lineIndex int) *function {
+	for _, f := range functions {
+		if lineIndex >= f.first && lineIndex <= f.last {
+			return f
+		}
+	}
+	return nil
+}
+
+// currentLine is the index of the line that is being transformed, and
+// lastLine is the index of the last line that is joined with it
+var currentLine, lastLine int
+
+// currentVariables returns the Go types of the variables in the function
+// that is being transformed
+func currentVariables() map[string]string {
+	if f := currentFunction(currentLine); f != nil {
+		return f.variables(currentLine)
+	}
+	return nil
+}
+
+// onHeap checks if the given local variable, that is declared on the line
+// that is being transformed, has its address taken and must be placed on the heap
+func onHeap(name string) bool {
+	return heapVariables[variable{name, currentLine}]
+}
+
+// onStack checks if the given local pointer variable, that is declared on the
+// line that is being transformed, points to a new value that is placed on the stack
+func onStack(name string) bool {
+	return stackPointers[variable{name, currentLine}]
+}
+
+// pointerEdits returns the edits that dereference pointers in a line of Go code:
+// * p.f is transformed to p->f, if p is a pointer
+// * *p++ is transformed to (*p)++
+// * new(T) is transformed to _gc_new(T{}) or _stack(T{}), a pointer to a new zero value
+// * (*T)(nil) is transformed to static_cast<T*>(nullptr)
+func pointerEdits(line string, file *ast.File, offset func(token.Pos) int, sites map[ast.Node]*allocation) []edit {
+	var edits []edit
+	variables := currentVariables()
+	text := func(n ast.Node) string {
+		if offset(n.Pos()) < 0 || offset(n.End()) > len(line) {
+			return ""
+		}
+		return line[offset(n.Pos()):offset(n.End())]
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			if strings.HasPrefix(typeOf(x.X, text, variables), "*") {
+				edits = append(edits, edit{offset(x.X.End()), offset(x.Sel.Pos()), "->"})
+			}
+		case *ast.IncDecStmt:
+			if _, ok := x.X.(*ast.StarExpr); ok {
+				edits = append(edits, edit{offset(x.X.Pos()), offset(x.X.Pos()), "("})
+				edits = append(edits, edit{offset(x.X.End()), offset(x.X.End()), ")"})
+			}
+		case *ast.CallExpr:
+			fun, ok := x.Fun.(*ast.Ident)
+			if ok && fun.Name == "new" && len(x.Args) == 1 {
+				edits = append(edits, edit{offset(x.Pos()), offset(x.End()), allocate(sites[x], TypeReplace(text(x.Args[0]))+"{}")})
+				return false
+			}
+			if paren, ok := x.Fun.(*ast.ParenExpr); ok && len(x.Args) == 1 {
+				if star, ok := paren.X.(*ast.StarExpr); ok {
+					edits = append(edits, edit{offset(x.Fun.Pos()), offset(x.Fun.End()), "static_cast<" + TypeReplace("*"+text(star.X)) + ">"})
+				}
+			}
+		}
+		return true
+	})
+	return edits
+}
+
+// HeapVariable transforms the C++ declaration of a variable that has its
+// address taken, so that the variable is placed on the heap. The
+// declaration is one of "T x {};", "T x = v" and "auto x = v".
+func HeapVariable(declaration, name string) string {
+	declaration = strings.TrimSuffix(declaration, ";")
+	if cppType, ok := strings.CutSuffix(declaration, " "+name+" {}"); ok {
+		return cppType + "& " + name + " = *_gc_new(" + cppType + "{});"
+	}
+	cppType, value, ok := strings.Cut(declaration, " "+name+" = ")
+	if !ok {
+		return declaration
+	}
+	if cppType == "auto" {
+		return "auto& " + name + " = *_gc_new(" + value + ");"
+	}
+	return cppType + "& " + name + " = *_gc_new(" + cppType + "(" + value + "));"
+}
+
+// allocate returns the C++ code for a pointer to a new variable with the
+// given value, which is placed on the heap unless the escape analysis found
+// that it can be placed on the stack
+func allocate(a *allocation, value string) string {
+	if a == nil || a.reason != "" {
+		return "_gc_new(" + value + ")"
+	}
+	return "_stack(" + value + ")"
+}
+
+// StackVariable transforms the C++ declaration of a pointer variable that
+// points to a new value on the stack, so that the value is placed in a
+// variable of its own, that lives as long as the pointer. The declaration
+// is one of "auto p = _stack(v)" and "T* p = _stack(v)".
+func StackVariable(declaration, name string) string {
+	declaration = strings.TrimSuffix(declaration, ";")
+	cppType, value, ok := strings.Cut(declaration, " "+name+" = ")
+	if !ok || !strings.HasPrefix(value, "_stack(") || matchingParenthesis(value, len("_stack")) != len(value)-1 {
+		// Not recognized, so the value is placed on the heap instead
+		return strings.Replace(declaration, "_stack(", "_gc_new(", 1)
+	}
+	return "auto _" + name + " = " + value[len("_stack("):len(value)-1] + ";\n" + cppType + " " + name + " = &_" + name + ";"
+}
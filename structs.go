@@ -0,0 +1,230 @@
+package main
+
+// Struct types: their fields, anonymous struct types and types that are declared in functions
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// structField is a field of a struct type
+type structField struct {
+	name   string
+	goType string
+}
+
+// localType is a type that is declared in the body of a function
+type localType struct {
+	line        int    // the line that the type is declared on
+	first, last int    // the lines of the block that the type is declared in
+	name        string // the name in the Go code
+	cppName     string // the unique name in the C++ code
+}
+
+var (
+	// The fields of the struct types in the source code, by type name
+	structTypes = map[string][]structField{}
+
+	// The types that are declared in the bodies of functions
+	localTypes []localType
+
+	// The names of the C++ classes for the anonymous struct types, by their
+	// fields. Anonymous struct types with the same fields are identical.
+	anonymousStructs = map[string]string{}
+
+	// The C++ classes for anonymous struct types that are not yet declared
+	structClasses []string
+)
+
+// fieldList returns the fields of a Go struct type
+func fieldList(source string, fields *ast.FieldList) []structField {
+	var result []structField
+	for _, field := range fields.List {
+		goType := source[field.Type.Pos()-1 : field.Type.End()-1]
+		if len(field.Names) == 0 {
+			// An embedded field has the name of the type
+			result = append(result, structField{strings.TrimPrefix(goType, "*"), goType})
+		}
+		for _, name := range field.Names {
+			result = append(result, structField{name.Name, goType})
+		}
+	}
+	return result
+}
+
+// StructFields returns the fields that are declared on a line of Go code
+// within a struct type, like "X, Y int"
+func StructFields(source string) []structField {
+	code := "package p\ntype _ struct {\n" + source + "\n}"
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, 0)
+	if err != nil {
+		panic("Unrecognized struct field: " + source)
+	}
+	spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+	return fieldList(code, spec.Type.(*ast.StructType).Fields)
+}
+
+// StructTypes finds the fields of the struct types that are declared in the
+// given lines of Go code, so that they are known before the types are used.
+// The types that are declared in functions are given unique names.
+func StructTypes(lines []string) {
+	structTypes = map[string][]structField{}
+	localTypes = nil
+	anonymousStructs = map[string]string{}
+	structClasses = nil
+	code := make([]string, len(lines))
+	for i, line := range lines {
+		code[i], _, _ = splitComment(line, false)
+	}
+	source := strings.Join(code, "\n")
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, 0)
+	if err != nil {
+		return
+	}
+	cppNames := map[string]bool{}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					cppNames[ts.Name.Name] = true
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						structTypes[ts.Name.Name] = fieldList(source, st.Fields)
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if d.Body == nil {
+				continue
+			}
+			var structs []*ast.TypeSpec
+			// The nodes that the current node is in, for finding the block of a type
+			var stack []ast.Node
+			ast.Inspect(d.Body, func(n ast.Node) bool {
+				if n == nil {
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				stack = append(stack, n)
+				ts, ok := n.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+				var block ast.Node = d.Body
+				for i := len(stack) - 1; i >= 0; i-- {
+					switch stack[i].(type) {
+					case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+						block = stack[i]
+					default:
+						continue
+					}
+					break
+				}
+				cppName := d.Name.Name + "_" + ts.Name.Name
+				for i := 2; cppNames[cppName]; i++ {
+					cppName = d.Name.Name + "_" + ts.Name.Name + strconv.Itoa(i)
+				}
+				cppNames[cppName] = true
+				line := fset.Position(ts.Name.Pos()).Line - 1
+				first := fset.Position(block.Pos()).Line - 1
+				last := fset.Position(block.End()).Line - 1
+				localTypes = append(localTypes, localType{line, first, last, ts.Name.Name, cppName})
+				if _, ok := ts.Type.(*ast.StructType); ok {
+					structs = append(structs, ts)
+				}
+				return true
+			})
+			for _, ts := range structs {
+				line := fset.Position(ts.Name.Pos()).Line - 1
+				fields := fieldList(source, ts.Type.(*ast.StructType).Fields)
+				for i, field := range fields {
+					fields[i].goType = LocalTypes(field.goType, line)
+				}
+				structTypes[LocalTypes(ts.Name.Name, line)] = fields
+			}
+		}
+	}
+	// As in Go, the keys of a map must be values that can be compared
+	ast.Inspect(file, func(n ast.Node) bool {
+		if m, ok := n.(*ast.MapType); ok {
+			pos := fset.Position(m.Key.Pos())
+			key := source[pos.Offset:fset.Position(m.Key.End()).Offset]
+			if incomparableType(LocalTypes(key, pos.Line-1)) != "" {
+				// The indentation is not a part of the code
+				line := lines[pos.Line-1]
+				column := pos.Column + len(line) - len(strings.TrimLeft(line, " \t"))
+				fmt.Fprintf(os.Stderr, "%s:%d:%d: invalid map key type %s\n", sourceFilename, pos.Line, column, key)
+				os.Exit(1)
+			}
+		}
+		return true
+	})
+}
+
+// LocalTypes replaces the names of the types that are declared in a function
+// with their unique names, if the types are in scope on the given line of Go
+// code. A type in an inner block shadows a type in an outer block.
+func LocalTypes(code string, lineIndex int) string {
+	cppNames := map[string]string{}
+	for _, t := range localTypes {
+		if t.line <= lineIndex && t.first <= lineIndex && lineIndex <= t.last {
+			cppNames[t.name] = t.cppName
+		}
+	}
+	for name, cppName := range cppNames {
+		code = replaceIdentifier(code, name, cppName)
+	}
+	return code
+}
+
+// StructTypeFields returns the fields of a Go struct type, like struct{ X, Y int }
+func StructTypeFields(goType string) []structField {
+	code := "package p\ntype _ " + goType
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, 0)
+	if err != nil {
+		panic("Unrecognized struct type: " + goType)
+	}
+	spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+	return fieldList(code, spec.Type.(*ast.StructType).Fields)
+}
+
+// AnonymousStruct returns the name of the C++ class for an anonymous Go
+// struct type, like struct{ Name string }. The class is added to
+// structClasses, unless there is a class for the same fields already.
+func AnonymousStruct(goType string) string {
+	fields := StructTypeFields(goType)
+	var key []string
+	for _, field := range fields {
+		key = append(key, field.name+" "+strings.Join(strings.Fields(field.goType), " "))
+	}
+	if name, ok := anonymousStructs[strings.Join(key, "; ")]; ok {
+		return name
+	}
+	name := "_struct_" + strconv.Itoa(len(anonymousStructs)+1)
+	anonymousStructs[strings.Join(key, "; ")] = name
+	structTypes[name] = fields
+	// The classes of the field types are declared first
+	structClasses = append(structClasses, StructClass(name, fields)+"\n")
+	return name
+}
+
+// StructClass returns the C++ class for a struct type with the given name
+// and fields, with the zero valued fields, the _str method, the methods for
+// comparing the values and the declarations of the methods of the type
+func StructClass(name string, fields []structField) string {
+	var sb strings.Builder
+	var names []string
+	sb.WriteString("class " + name + " { public:\n")
+	for _, field := range fields {
+		sb.WriteString(TypeReplace(field.goType) + " " + field.name + " {};\n")
+		names = append(names, field.name)
+	}
+	sb.WriteString(CreateStrMethod(names) + CreateComparisonMethods(name, names) + MethodDeclarations(name) + "};")
+	return sb.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import "fmt"
+
+// port returns the port of a server, or 80
+func port(server struct {
+	Host string
+	Port int
+}) int {
+	if server.Port == 0 {
+		return 80
+	}
+	return server.Port
+}
+
+func sum() int {
+	// This type is not the same as the pair type in main
+	type pair struct {
+		a, b int
+	}
+	p := pair{1, 2}
+	return p.a + p.b
+}
+
+func main() {
+	cfg := struct {
+		Host string
+		Port int
+	}{"localhost", 80}
+	fmt.Println(cfg.Host, cfg.Port)
+
+	// Anonymous struct types with the same fields are identical
+	other := struct {
+		Host string
+		Port int
+	}{Host: "example.com"}
+	fmt.Println(other, port(other))
+	other = cfg
+	fmt.Println(other, other == cfg)
+
+	tests := []struct {
+		in, want string
+	}{
+		{"a", "A"},
+		{in: "b", want: "B"},
+	}
+	for _, tt := range tests {
+		fmt.Println(tt.in, tt.want)
+	}
+
+	type pair struct {
+		key   string
+		value int
+	}
+	p := pair{"k", 1}
+	fmt.Println(p, p == pair{"k", 1}, sum())
+
+	label := struct{ Text string }{"hi"}
+	fmt.Println(label.Text)
+
+	type celsius float64
+	var t celsius = 21.5
+	fmt.Println(t)
+
+	// Types with the same name in different blocks are different types
+	for i := 0; i < 2; i++ {
+		if i == 0 {
+			type entry struct {
+				name string
+			}
+			e := entry{"first"}
+			fmt.Println(e.name)
+		} else {
+			type entry struct {
+				id    int
+				score float64
+			}
+			e := entry{2, 0.5}
+			fmt.Println(e.id, e.score)
+		}
+	}
+
+	// A type in an inner block shadows the type in the outer block
+	type point struct{ x, y int }
+	{
+		type point struct{ name string }
+		q := point{"inner"}
+		fmt.Println(q.name)
+	}
+	r := point{1, 2}
+	fmt.Println(r.x, r.y, r)
+}
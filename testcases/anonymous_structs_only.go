@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+// Only anonymous struct types, and no named struct types
+
+func main() {
+	fmt.Println(struct {
+		Name string
+		Port int
+	}{"x", 80})
+	point := struct{ X, Y int }{1, 2}
+	fmt.Println(point, point.X+point.Y)
+	points := []struct{ X, Y int }{{3, 4}, {5, 6}}
+	for _, p := range points {
+		fmt.Println(p)
+	}
+}
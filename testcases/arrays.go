@@ -0,0 +1,87 @@
+package main
+
+import "fmt"
+
+type Board struct {
+	Cells [3][3]int
+	Name  string
+}
+
+// doubled returns a doubled copy of the given array
+func doubled(a [4]int) [4]int {
+	for i := 0; i < len(a); i++ {
+		a[i] *= 2
+	}
+	return a
+}
+
+// window returns a slice of a local array, which is moved to the heap
+func window() []int {
+	digits := [...]int{0, 1, 2, 3, 4}
+	return digits[1:4]
+}
+
+func main() {
+	var zero [4]int
+	fmt.Println(zero, len(zero))
+
+	// Arrays are values, so assignments and arguments are copies
+	a := [4]int{1, 2, 3, 4}
+	b := a
+	b[0] = 100
+	c := doubled(a)
+	fmt.Println(a, b, c)
+	fmt.Println(a == b, a == [4]int{1, 2, 3, 4})
+
+	// The length is a constant
+	const n = len(a)
+	var squares [n]int
+	for i := range squares {
+		squares[i] = i * i
+	}
+	fmt.Println(squares, n)
+
+	// The length may be given by the number of elements
+	words := [...]string{"x", "y", "z"}
+	fmt.Println(len(words), words)
+
+	grid := [2][3]int{{1, 2, 3}, {4, 5, 6}}
+	grid[1][2] = 60
+	fmt.Println(grid, len(grid), len(grid[0]))
+
+	board := Board{Name: "tic-tac-toe"}
+	board.Cells[1][1] = 1
+	other := board
+	other.Cells[0][0] = 2
+	fmt.Println(board.Cells, other.Cells[0], board == other)
+
+	// Arrays can be map keys
+	seen := map[[2]int]string{}
+	seen[[2]int{1, 2}] = "a"
+	seen[[2]int{2, 1}] = "b"
+	fmt.Println(seen[[2]int{1, 2}], len(seen))
+
+	sum := 0
+	for _, v := range a {
+		sum += v
+	}
+	fmt.Println(sum)
+
+	// Slicing an array shares its elements
+	d := [...]int{10, 20, 30, 40, 50}
+	s := d[1:3]
+	s[0] = 21
+	d[2] = 31
+	fmt.Println(d, s, len(s), cap(s))
+	s = append(s, 41)
+	fmt.Println(d, s)
+	t := d[:2:3]
+	u := d[3:]
+	fmt.Println(t, len(t), cap(t), u, len(u), cap(u))
+	all := d[:]
+	all[4] = 51
+	fmt.Println(d[4], len(all))
+	w := window()
+	w = append(w, 99)
+	fmt.Println(w, len(w), cap(w))
+}
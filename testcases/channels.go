@@ -0,0 +1,63 @@
+package main
+
+import "fmt"
+
+// fill sends the given numbers to a channel that only sends
+func fill(ch chan<- int, numbers ...int) {
+	for _, n := range numbers {
+		ch <- n
+	}
+}
+
+type Point struct {
+	X, Y int
+}
+
+// first receives a pointer from a receive-only channel
+func firstX(points <-chan *Point) int {
+	p := <-points
+	return p.X
+}
+
+func main() {
+	ch := make(chan int, 3)
+	fill(ch, 1, 2)
+	ch <- 3
+	fmt.Println(len(ch), cap(ch))
+
+	first := <-ch
+	fmt.Println(first, <-ch+10)
+
+	v, ok := <-ch
+	fmt.Println(v, ok)
+
+	// Receiving from a closed channel gives the zero value
+	close(ch)
+	v, ok = <-ch
+	fmt.Println(v, ok, <-ch)
+
+	words := make(chan string, 4)
+	words <- "a"
+	words <- "b"
+	words <- "c"
+	close(words)
+	for w := range words {
+		fmt.Println(w)
+	}
+
+	var done <-chan bool
+	fmt.Println(done == nil)
+
+	// The values that are received have the element type of the channel
+	points := make(chan *Point, 3)
+	points <- &Point{1, 2}
+	points <- &Point{3, 4}
+	points <- &Point{5, 6}
+	p := <-points
+	fmt.Println(p.X, (<-points).Y, firstX(points))
+
+	// Nothing else can receive, so sending to a full channel is a deadlock
+	unbuffered := make(chan int)
+	unbuffered <- 1
+	fmt.Println("not reached")
+}
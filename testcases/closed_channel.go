@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func main() {
+	defer fmt.Println("main is done")
+	ch := make(chan int, 1)
+	ch <- 1
+	close(ch)
+	fmt.Println(<-ch)
+	close(ch)
+}
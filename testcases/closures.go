@@ -0,0 +1,59 @@
+package main
+
+import "fmt"
+
+// The closure that is assigned to a package variable outlives setup
+var greet func() string
+
+// counter returns a closure that keeps counting after counter has returned
+func counter() func() int {
+	c := 0
+	return func() int {
+		c++
+		return c
+	}
+}
+
+// adder returns a closure that uses the parameter of adder
+func adder(sum int) func(int) int {
+	return func(x int) int {
+		sum += x
+		return sum
+	}
+}
+
+func setup(name string) {
+	greeting := "hello " + name
+	greet = func() string {
+		return greeting
+	}
+}
+
+func main() {
+	next, other := counter(), counter()
+	fmt.Println(next(), next(), other(), next())
+
+	add := adder(10)
+	add(5)
+	fmt.Println(add(1))
+
+	setup("gopher")
+	fmt.Println(greet())
+
+	// Each closure has its own variable from the block
+	var squares []func() int
+	for i := range 3 {
+		square := i * i
+		get := func() int { return square }
+		squares = append(squares, get)
+	}
+	fmt.Println(squares[0](), squares[1](), squares[2]())
+
+	// Two closures share the same variable
+	total := 0
+	inc := func() { total++ }
+	value := func() int { return total }
+	inc()
+	inc()
+	fmt.Println(value(), total)
+}
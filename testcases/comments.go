@@ -0,0 +1,26 @@
+// Example for comments
+package main
+
+import (
+	"fmt"
+)
+
+/*
+This block comment spans
+several lines.
+*/
+
+/* A single-line block comment */
+func main() {
+	s := "http://example.com" // a trailing comment
+	fmt.Println(s)            // print the URL
+	t := "/* not a comment */"
+	fmt.Println(t)
+	x := 1 /* one */ + 2 /* two */
+	fmt.Println(x)       /* a trailing block comment */
+	// fmt.Println("this line is commented out")
+	y := x * 2 /* this comment
+	continues on the next line */
+	fmt.Println(y)
+	fmt.Println("//", '/')
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"math/cmplx"
+)
+
+const C = 3 + 4i
+
+var unit complex64 = 1i
+
+func main() {
+	a := 1 + 2i
+	b := complex(3.5, -1.25)
+	var c complex128 = 2i
+	fmt.Println(a, b, c)
+	fmt.Println(a+b, a-b, a*b, a/c)
+	fmt.Println(real(b), imag(b), a == 1+2i, a != b)
+	fmt.Println(C, cmplx.Abs(C), cmplx.Conj(C))
+	var d complex64 = complex(float32(1.5), float32(2))
+	fmt.Println(d, real(d))
+	var g complex64 = 1 + 2i
+	var h complex64 = complex(1, 2)
+	fmt.Println(g, h, g*h, unit)
+	e := 1234567.0
+	f := 0.00001
+	fmt.Println(cmplx.Sqrt(-1), cmplx.Phase(1i), e, f)
+}
@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+type Line struct {
+	Start, End Point
+	Label      string
+}
+
+type Path []Point
+
+func main() {
+	// Keyed fields may be given in any order, and may be left out
+	p := Point{Y: 2, X: 1}
+	q := Point{X: 5}
+	fmt.Println(p, q)
+
+	l := Line{End: Point{3, 4}, Label: "diagonal"}
+	fmt.Println(l)
+
+	// The types of the elements may be elided
+	points := []Point{{1, 2}, {X: 3}, {}}
+	fmt.Println(points, len(points))
+
+	pointers := []*Point{{7, 8}}
+	fmt.Println(*pointers[0])
+
+	path := Path{{0, 0}, {1, 1}}
+	fmt.Println(len(path), path[1])
+
+	m := map[string][]int{"a": {1}, "b": {2, 3}}
+	fmt.Println(m["b"], len(m["a"]))
+
+	corners := map[string]Point{"origin": {}, "top": {Y: 10}}
+	fmt.Println(corners["top"], corners["origin"])
+
+	origin := &Point{}
+	fmt.Println(origin)
+
+	// Elements may be given at an index, the other elements are zero
+	names := [...]string{2: "x", 0: "z"}
+	fmt.Println(len(names), names[2], names[1] == "")
+
+	lines := []Line{
+		{
+			Start: Point{1, 1},
+			Label: "first",
+		},
+		{Label: "second"},
+	}
+	fmt.Println(lines[0].Start, lines[1].Label, len(lines))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type Celsius float64
+
+const (
+	Big   = 1 << 100
+	Small = Big >> 98
+	Huge  = 1 << 62
+	MaxU  = math.MaxUint64
+)
+
+const Half = 0.5
+
+const N int = 10 * Half
+
+const Ratio = 7 / 2
+
+const Flags uint8 = ^uint8(0)
+
+const Name = "go" + "2" + "cpp"
+
+const NameLen = len(Name)
+
+const Mask = 0xFF &^ 0x0F
+
+const Boiling Celsius = 100
+
+const IsBig = Big > Huge
+
+const TwoPi = 2 * math.Pi
+
+const Rounded = int64(TwoPi * 1000 / 1000 * 0)
+
+const Thousands = 100000
+
+const Level = 1
+
+// levels returns constants that shadow the package level constant
+func levels() (int, int) {
+	const Level = 1000
+	const Next = Level + 1
+	return Level, Next
+}
+
+func main() {
+	fmt.Println(Small, Huge, N, Half, Ratio, Flags)
+	fmt.Println(Name, NameLen, Mask, Boiling, IsBig, Rounded)
+	var u uint64 = MaxU
+	fmt.Println(u, TwoPi > 6.28)
+	// An untyped integer constant is an int, which is 64 bits
+	square := Thousands * Thousands
+	fmt.Println(square)
+
+	// The constants are scoped by function and block
+	inner, next := levels()
+	const Next = Level + 1
+	fmt.Println(inner, next, Next)
+	{
+		const Level = 5
+		const Double = Level * 2
+		fmt.Println(Level, Double)
+	}
+	const Double = Level * 2
+	fmt.Println(Double)
+
+	// Constants that are too large for any type can be used in constant expressions
+	shifted := Big >> 98
+	var half float64 = Big * 0.5
+	fmt.Println(shifted, Big/Big+shifted, uint64(Big>>37), half > 1e29, Big > Huge)
+	var exact float64 = Big
+	fmt.Println(exact)
+
+	// An untyped float constant with an integer value can be used where an integer is needed
+	const F = 2.5 * 2
+	var cells [F]int
+	xs := []int{1, 2, 3, 4, 5, 6}
+	fmt.Println(len(cells), xs[F], xs[F-1:], 1<<F, F)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "fmt"
+
+type Counter struct {
+	n int
+}
+
+func (c *Counter) Inc() {
+	c.n++
+}
+
+func (c Counter) Show(label string) {
+	fmt.Println(label, c.n)
+}
+
+func twice(x int) int {
+	fmt.Println("twice", x)
+	return x * 2
+}
+
+func run() {
+	var c Counter
+	// The function literal has its own deferred calls
+	func() {
+		defer c.Inc()
+	}()
+	fmt.Println("after closure", c.n)
+
+	// The receiver is evaluated when the defer statement is executed
+	defer c.Show("deferred show")
+	p := &c
+	defer p.Inc()
+	c.n = 5
+
+	// The arguments are evaluated when the defer statement is executed
+	defer fmt.Println("deferred", twice(c.n))
+	fmt.Println("end of run", c.n)
+}
+
+func main() {
+	run()
+	greet := func(name string) {
+		defer fmt.Println("bye", name)
+		fmt.Println("hello", name)
+	}
+	greet("a")
+	greet("b")
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+func average(total, count int) int {
+	defer fmt.Println("average is done")
+	return total / count
+}
+
+func main() {
+	defer fmt.Println("main is done")
+	x := 7
+	x %= 4
+	y := average(9, 3)
+	fmt.Println(x, 7.0/2, y)
+	fmt.Println(average(1, 0))
+}
@@ -0,0 +1,66 @@
+// Example for doc comments
+package main
+
+import (
+	"fmt"
+)
+
+// Vec2 is a two-dimensional vector
+type Vec2 struct {
+	// X is the horizontal component
+	X float64
+	// Y is the vertical component
+	Y float64
+}
+
+// Answer is the answer
+const Answer = 42
+
+// Weekdays
+const (
+	// Monday is the first day of the week
+	Monday = "Monday"
+	// Tuesday is the second day of the week
+	Tuesday = "Tuesday"
+)
+
+// Temperatures
+type (
+	// Celsius is degrees Celsius
+	Celsius float64
+	// Kelvin is degrees above absolute zero
+	Kelvin float64
+)
+
+// Old is an old type.
+//
+// Deprecated: use Vec2 instead.
+type Old struct {
+	A int
+}
+
+// OldAnswer is the old answer.
+// Deprecated: use Answer instead.
+const OldAnswer = 41
+
+// Add returns the sum of two numbers.
+//
+// Deprecated: use the + operator instead,
+// since it is shorter.
+func Add(a int, b int) int {
+	return a + b
+}
+
+// This comment is not a doc comment, since it is followed by a blank line
+
+// Sub returns the difference
+func Sub(a int, b int) int {
+	return a - b
+}
+
+func main() {
+	// Not a doc comment
+	fmt.Println(Add(Answer, 1), Sub(Answer, 1))
+	fmt.Println(Monday, Tuesday, OldAnswer)
+	fmt.Println(Celsius(21.5), Kelvin(0))
+}
@@ -0,0 +1,105 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+type Node struct {
+	Value int
+	Next  *Node
+}
+
+type Holder struct {
+	P *int
+}
+
+// length does not keep the pointer, so the point can be on the stack of the caller
+func length(p *Point) int {
+	return p.X*p.X + p.Y*p.Y
+}
+
+// keep returns the pointer, so the point must be on the heap
+func keep(p *Point) *Point {
+	return p
+}
+
+// sum does not keep the pointers either, even if it is recursive
+func sum(n *Node) int {
+	if n == nil {
+		return 0
+	}
+	return n.Value + sum(n.Next)
+}
+
+// counter returns a closure that uses the variable after counter returns,
+// so the variable must be on the heap
+func counter() func() int {
+	c := 0
+	return func() int {
+		c++
+		return c
+	}
+}
+
+func move(p *Point, dx int) {
+	p.X += dx
+}
+
+func main() {
+	// Only used in the function, so these are on the stack
+	a := &Point{1, 2}
+	move(a, 2)
+	var b *Point = &Point{X: 1, Y: 1}
+	b.Y = 5
+	fmt.Println(a.X, a.Y, length(a), length(b), length(&Point{3, 4}))
+
+	second := &Node{Value: 2}
+	first := &Node{Value: 1, Next: second}
+	fmt.Println(sum(first), sum(&Node{Value: 3}))
+
+	n := new(int)
+	*n = 42
+	fmt.Println(*n)
+
+	x := 1
+	h := Holder{P: &x}
+	*h.P = 8
+	fmt.Println(x)
+
+	// The pointer is returned, so the point is on the heap
+	k := keep(&Point{5, 6})
+	fmt.Println(k.X, k.Y)
+
+	// The variable in the block is used after the block
+	var outer *int
+	if x > 0 {
+		inner := 3
+		outer = &inner
+	}
+	fmt.Println(*outer)
+
+	// Each iteration has its own variable
+	var ptrs []*int
+	for i := 0; i < 3; i++ {
+		v := i * 10
+		ptrs = append(ptrs, &v)
+	}
+	fmt.Println(*ptrs[0], *ptrs[1], *ptrs[2])
+
+	// A closure uses the variable
+	count := 0
+	p := &count
+	inc := func() {
+		count++
+	}
+	inc()
+	inc()
+	*p++
+	fmt.Println(count, *p)
+
+	// Each closure has its own variable, which outlives the call to counter
+	next, other := counter(), counter()
+	fmt.Println(next(), next(), other(), next())
+}
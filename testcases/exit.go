@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	// The deferred function calls are not made when os.Exit is called
+	defer fmt.Println("this is not printed")
+	for i := 0; i < 10; i++ {
+		fmt.Println(i)
+		if i == 3 {
+			os.Exit(3)
+		}
+	}
+}
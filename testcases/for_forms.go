@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+)
+
+func countTo3(yield func(int) bool) {
+	for i := 1; i <= 3; i++ {
+		if !yield(i) {
+			return
+		}
+	}
+}
+
+func pairs(yield func(string, int) bool) {
+	if !yield("a", 1) {
+		return
+	}
+	yield("b", 2)
+}
+
+// upTo returns an iterator over the numbers from 1 to n
+func upTo(n int) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for i := 1; i <= n; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+// total ranges over an iterator that is given as an argument
+func total(seq iter.Seq[int]) int {
+	sum := 0
+	for v := range seq {
+		sum += v
+	}
+	return sum
+}
+
+// find returns from the function in the body of a for loop over an iterator function
+func find(target int) int {
+	for v := range countTo3 {
+		if v == target {
+			return v * 10
+		}
+	}
+	return -1
+}
+
+// findPair returns from two nested for loops over iterator functions
+func findPair(key string, target int) (string, int) {
+	for k, v := range pairs {
+		for w := range countTo3 {
+			if k == key && v*w == target {
+				return k, w
+			}
+		}
+	}
+	return "", 0
+}
+
+// first returns the named result from the body of a for loop over an iterator function
+func first() (result int) {
+	for v := range countTo3 {
+		result = v
+		return
+	}
+	return 42
+}
+
+func main() {
+	for i := range 3 {
+		fmt.Println("int", i)
+	}
+	n := 2
+	for range n {
+		fmt.Println("hello")
+	}
+	x := 0
+	for x < 3 {
+		x++
+	}
+	fmt.Println("x is", x)
+	for i, r := range "héllo" {
+		fmt.Println(i, r)
+	}
+	for i := range "hé!" {
+		fmt.Println("index", i)
+	}
+	list := []string{"a", "b", "c"}
+	var idx int
+	var val string
+	for idx, val = range list {
+		fmt.Println(idx, val)
+	}
+	fmt.Println("last", idx, val)
+	for _, v := range list {
+		fmt.Println(v)
+	}
+	for v := range countTo3 {
+		if v == 2 {
+			continue
+		}
+		fmt.Println("yielded", v)
+	}
+	for v := range countTo3 {
+		if v == 2 {
+			break
+		}
+		fmt.Println("before break", v)
+	}
+	for k, v := range pairs {
+		fmt.Println(k, v)
+	}
+	for range countTo3 {
+		fmt.Println("tick")
+	}
+	fmt.Println(find(3), find(4))
+	k, w := findPair("b", 4)
+	fmt.Println(k, w)
+	fmt.Println(first())
+Outer:
+	for i := range 3 {
+		for v := range countTo3 {
+			if v == 2 {
+				continue Outer
+			}
+			if i == 2 {
+				break Outer
+			}
+			fmt.Println("labeled", i, v)
+		}
+		fmt.Println("not reached")
+	}
+Loop:
+	for k := range pairs {
+		for v := range countTo3 {
+			if v == 2 {
+				continue Loop
+			}
+			if k == "b" {
+				break Loop
+			}
+			fmt.Println("nested", k, v)
+		}
+	}
+	fmt.Println("done")
+	numbers := []int{1, 2, 3}
+	for i, v := range numbers {
+		if i == 0 {
+			numbers[2] = 100
+		}
+		fmt.Println("element", i, v)
+	}
+	seq := upTo(4)
+	for v := range seq {
+		fmt.Println("from a variable", v)
+	}
+	var counter iter.Seq[int] = countTo3
+	fmt.Println(total(seq), total(counter))
+
+	// The loop variables are ints, which are 64 bits
+	for i := 3000000; i < 3000001; i++ {
+		fmt.Println("square", i*i)
+	}
+	for i := range 3000001 {
+		if i == 3000000 {
+			fmt.Println("range square", i*i)
+		}
+	}
+	for i := range list {
+		fmt.Println("shifted index", i<<40)
+	}
+	for i, r := range "hi" {
+		fmt.Println("shifted", i<<40, r)
+	}
+	var y = 3000000
+	fmt.Println("var square", y*y)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Functions with the same names as functions in the C and C++ standard libraries
+
+func div(a, b int) (int, bool) {
+	if b == 0 {
+		return 0, false
+	}
+	return a / b, true
+}
+
+func apply(f func(int) int, x int) int {
+	return f(x)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func main() {
+	q, ok := div(7, 2)
+	fmt.Println(q, ok)
+	q, ok = div(1, 0)
+	fmt.Println(q, ok)
+	fmt.Println(apply(func(x int) int { return x * 2 }, 21))
+	fmt.Println(abs(-3000000000))
+	fmt.Println(1<<40, 3000000*3000000)
+}
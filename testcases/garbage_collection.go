@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type Node struct {
+	Value int
+	Next  *Node
+}
+
+// list returns a linked list with the values from 0 to n-1
+func list(n int) *Node {
+	var head *Node
+	for i := n - 1; i >= 0; i-- {
+		head = &Node{Value: i, Next: head}
+	}
+	return head
+}
+
+func sum(head *Node) int {
+	total := 0
+	for n := head; n != nil; n = n.Next {
+		total += n.Value
+	}
+	return total
+}
+
+func main() {
+	var before runtime.MemStats
+	var after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// The lists that are no longer used are collected while new lists are created
+	for i := 0; i < 100; i++ {
+		list(10000)
+	}
+	kept := list(1000)
+	nodes := []*Node{}
+	for i := 0; i < 1000; i++ {
+		nodes = append(nodes, &Node{Value: i})
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	fmt.Println(after.NumGC > before.NumGC, after.Mallocs-before.Mallocs >= 1000000, after.Frees > before.Frees)
+	fmt.Println(after.HeapAlloc < 1<<20)
+
+	// The values that can still be reached are not collected
+	total := 0
+	for _, n := range nodes {
+		total += n.Value
+	}
+	fmt.Println(sum(kept), total)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+)
+
+func half(x int) (int, int) {
+	return x / 2, x % 2
+}
+
+func twice(x int) int {
+	return x * 2
+}
+
+func main() {
+	if x := twice(3); x > 5 {
+		fmt.Println("x is larger than five:", x)
+	}
+	for i := 0; i < 4; i++ {
+		if a := twice(i); a == 0 {
+			fmt.Println("zero")
+		} else if b := a + 1; b == 3 {
+			fmt.Println("a and b are", a, b)
+		} else if q, r := half(b); r == 1 {
+			fmt.Println("a, b, q and r are", a, b, q, r)
+		} else {
+			fmt.Println("else", a, b, q, r)
+		}
+	}
+	if s := "{}"; s != "" {
+		fmt.Println(s)
+	}
+}
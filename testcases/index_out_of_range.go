@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+func get(xs []int, i int) int {
+	defer fmt.Println("get is done")
+	return xs[i]
+}
+
+func main() {
+	// The deferred function calls are made before the program exits with exit status 2
+	defer fmt.Println("main is done")
+	xs := []int{1, 2, 3}
+	for i := 0; i < 5; i++ {
+		fmt.Println(get(xs, i))
+	}
+	fmt.Println("this is not printed")
+}
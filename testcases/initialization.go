@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The variables are initialized in dependency order, not in the order of the declarations
+var (
+	a = b + 1
+	b = f()
+	c = "c"
+)
+
+var total int
+
+var names = []string{"x", "y", "z"}
+
+var counted = count()
+
+var first = trace("first")
+
+var second = trace("second")
+
+// The type of s is found from the value, for declaring it before pad
+var s = strings.TrimSpace(pad) + "!"
+
+var pad = " x "
+
+// The variables that are given the results of a function call are initialized together
+var lo, hi int = bounds()
+
+var limit = 5
+
+// The types are found from the results of the function
+var word, size = describe()
+
+var suffix = "s"
+
+// The variables that the methods refer to are initialized first
+var ticks int = counter{1}.plus()
+
+var step = 10
+
+type counter struct {
+	n int
+}
+
+func (c counter) plus() int {
+	return c.n + step
+}
+
+func bounds() (int, int) {
+	return 1, limit
+}
+
+func describe() (string, int) {
+	return "word" + suffix, len(suffix)
+}
+
+func f() int {
+	fmt.Println("f is called")
+	return 41
+}
+
+func count() int {
+	total += len(names)
+	return total
+}
+
+func trace(s string) string {
+	fmt.Println("initializing", s)
+	return s
+}
+
+// There may be several init functions, which are called in order
+func init() {
+	fmt.Println("first init", a, b, c)
+}
+
+func init() {
+	fmt.Println("second init", counted)
+	total++
+}
+
+func main() {
+	fmt.Println("main", a, b, c, total, first, second, s)
+	fmt.Println(lo, hi, ticks, word, size)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+)
+
+type Weekday int
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+)
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+)
+
+const (
+	A, B = iota, iota * 10
+	C, D
+	_, _
+	E, F
+)
+
+const (
+	First = "first"
+	Second
+	Third = iota
+	Fourth
+)
+
+const Zero = iota
+
+const (
+	Bit0, Mask0 uint8 = 1 << iota, 1<<iota - 1
+	Bit1, Mask1
+	Bit2, Mask2
+)
+
+func main() {
+	fmt.Println(Sunday, Monday, Tuesday)
+	fmt.Println(KB, MB, GB)
+	fmt.Println(A, B, C, D, E, F)
+	fmt.Println(First, Second, Third, Fourth, Zero)
+	fmt.Println(Bit0, Mask0, Bit1, Mask1, Bit2, Mask2)
+}
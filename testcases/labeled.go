@@ -0,0 +1,48 @@
+// Example for labeled break and continue
+package main
+
+import (
+	"fmt"
+)
+
+func main() {
+Outer:
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if j == 2 {
+				continue Outer
+			}
+			if i == 2 {
+				break Outer
+			}
+			fmt.Println(i, j)
+		}
+		x := i * 10
+		fmt.Println("never reached", x)
+	}
+Loop:
+	for n := 0; ; n++ {
+		switch {
+		case n == 1:
+			fmt.Println("one")
+			continue Loop
+		case n > 3:
+			break Loop
+		}
+		fmt.Println("n is", n)
+	}
+	k := 0
+Switch:
+	switch k {
+	case 0:
+		for {
+			fmt.Println("in the loop")
+			break Switch
+		}
+		fmt.Println("not reached")
+	}
+	fmt.Println("done")
+	goto end
+end:
+	fmt.Println("end")
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func main() {
+	defer fmt.Println("this is not printed")
+	fmt.Println("starting")
+	values := []int{1, 2, 3}
+	if len(values) < 4 {
+		log.Fatal("too few values: ", len(values))
+	}
+	fmt.Println("this is not printed either")
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func main() {
+	defer fmt.Println("this is not printed")
+	name := "config"
+	missing := 2
+	fmt.Println("checking", name)
+	if missing > 0 {
+		log.Fatalf("%s: %d values are missing (%.1f%%)", name, missing, 12.5)
+	}
+	fmt.Println("this is not printed either")
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func main() {
+	defer fmt.Println("this is not printed")
+	values := []int{1, 2, 3}
+	fmt.Println("starting")
+	if len(values) < 4 {
+		log.Fatalln("too few values:", len(values), "of", 4, true)
+	}
+	fmt.Println("this is not printed either")
+}
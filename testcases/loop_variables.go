@@ -0,0 +1,45 @@
+package main
+
+import "fmt"
+
+func main() {
+	// Each iteration has its own i, since Go 1.22
+	first := func() int { return -1 }
+	last := first
+	for i := 0; i < 3; i++ {
+		f := func() int { return i * 10 }
+		if i == 0 {
+			first = f
+		}
+		last = f
+	}
+	fmt.Println(first(), last())
+
+	// The loop body and the function literal use the same variable
+	for i := 0; i < 4; i++ {
+		get := func() int {
+			return i
+		}
+		i++
+		fmt.Println(get())
+	}
+
+	// Range loops also have new variables for each iteration
+	words := []string{"zero", "one", "two"}
+	show := func() {}
+	for i, word := range words {
+		if i == 1 {
+			show = func() {
+				fmt.Println(i, word)
+			}
+		}
+	}
+	show()
+
+	// Loop variables that are not captured are left as they are
+	sum := 0
+	for i := range 5 {
+		sum = sum + i
+	}
+	fmt.Println(sum)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+func main() {
+	defer fmt.Println("the deferred calls are made")
+	for i := 0; i < 10; i++ {
+		if i == 2 {
+			fmt.Println("returning early")
+			return
+		}
+		fmt.Println(i)
+	}
+	fmt.Println("this is not printed")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Counter struct {
+	name string
+	n    int
+}
+
+func (c *Counter) Add(d int) {
+	c.n += d
+}
+
+func (c Counter) Get() int {
+	return c.n
+}
+
+func (c Counter) Label(prefix string) string {
+	return prefix + c.name
+}
+
+type Person struct {
+	name string
+	age  int
+}
+
+func (p Person) Older(q Person) bool {
+	return p.age > q.age
+}
+
+func apply(f func(int), x int) {
+	f(x)
+}
+
+func main() {
+	c := &Counter{name: "c"}
+
+	// Method values
+	add := c.Add
+	add(2)
+	apply(c.Add, 3)
+	fmt.Println(c.Get())
+
+	// A value receiver is copied when the method value is evaluated
+	get := c.Get
+	c.Add(10)
+	fmt.Println(c.Get(), get())
+
+	// Method expressions take the receiver as the first argument
+	inc := (*Counter).Add
+	inc(c, 1)
+	value := Counter.Get
+	label := Counter.Label
+	fmt.Println(value(*c), label(*c, "counter "))
+
+	// A registry of callbacks
+	var d Counter
+	callbacks := map[string]func(int){"c": c.Add, "d": d.Add}
+	callbacks["c"](4)
+	callbacks["d"](7)
+	fmt.Println(c.n, d.n)
+	handlers := []func() int{c.Get, d.Get}
+	for _, h := range handlers {
+		fmt.Println(h())
+	}
+
+	// Sorting with a comparator that uses a method
+	people := []Person{{"Alice", 30}, {"Bob", 25}, {"Carol", 35}, {"Dave", 30}}
+	sort.Slice(people, func(i, j int) bool { return people[i].Older(people[j]) })
+	for _, p := range people {
+		fmt.Println(p.name, p.age)
+	}
+	xs := []int{5, 2, 8, 1}
+	sort.Slice(xs, func(i, j int) bool { return xs[i] < xs[j] })
+	fmt.Println(xs)
+}
@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+func next(n int) (int, bool) {
+	return n + 1, n+1 < 3
+}
+
+func main() {
+	// Swapping two variables
+	a, b := 1, 2
+	a, b = b, a
+	fmt.Println(a, b)
+
+	// Rotating three variables
+	x, y, z := "x", "y", "z"
+	x, y, z = y, z, x
+	fmt.Println(x, y, z)
+
+	// The values are evaluated before any variable is assigned to
+	i, j := 0, 1
+	i, j = j, i+j
+	i, j = j, i+j
+	fmt.Println(i, j)
+
+	// := reuses the variables that are already declared in the same scope
+	q, r := divmod(17, 5)
+	q, s := divmod(q*10, 3)
+	fmt.Println(q, r, s)
+
+	// Blank identifiers
+	_, r = divmod(23, 7)
+	n, _ := divmod(23, 7)
+	_ = n
+	fmt.Println(n, r)
+
+	// := in a new scope declares new variables
+	n, ok := next(0)
+	for ok {
+		n, ok := next(n)
+		fmt.Println("inner", n, ok)
+		break
+	}
+	fmt.Println("outer", n, ok)
+
+	// Assigning to several variables in a for loop
+	for lo, hi := 0, 5; lo < hi; lo, hi = lo+1, hi-1 {
+		fmt.Println(lo, hi)
+	}
+
+	// The variables are ints, which are 64 bits
+	c, d := 1, 3000000
+	c <<= 40
+	fmt.Println(c, d*d)
+	for e, f := 0, 3000000; e < 1; e++ {
+		fmt.Println(e, f*f)
+	}
+	const k = 3000000
+	g, h := k, len("ab")
+	fmt.Println(g*g, h<<40)
+
+	// Looking up a key in a map also gives if the key is in the map
+	m := map[string]int{"a": 1, "b": 2}
+	v, found := m["c"]
+	fmt.Println(v, found, len(m))
+	v, found = m["a"]
+	fmt.Println(v, found)
+	if n, ok := m["b"]; ok {
+		fmt.Println("b is", n)
+	}
+	_, found = m["d"]
+	var w, present = m["b"]
+	fmt.Println(found, w, present)
+}
@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+func divide(a, b int) (quotient, remainder int) {
+	quotient = a / b
+	remainder = a % b
+	return
+}
+
+func zero() (n int, s string, ok bool) {
+	return
+}
+
+func first(xs string) (b byte, found bool) {
+	if xs == "" {
+		return
+	}
+	return xs[0], true
+}
+
+// Deferred function literals may modify the named results
+func plusOneTwice(n int) (result int) {
+	defer func() {
+		result *= 2
+	}()
+	return n + 1
+}
+
+func counter() (count int) {
+	for i := 0; i < 3; i++ {
+		defer func() { count++ }()
+	}
+	return 10
+}
+
+// The arguments of deferred calls are evaluated right away
+func trace(name string) (s string) {
+	defer fmt.Println("leaving", name)
+	s = "in " + name
+	name = "changed"
+	return
+}
+
+func main() {
+	defer fmt.Println("main is done")
+	q, r := divide(17, 5)
+	fmt.Println(q, r)
+	n, s, ok := zero()
+	fmt.Println(n, s, ok)
+	b, found := first("xyz")
+	fmt.Println(b, found)
+	fmt.Println(plusOneTwice(4))
+	fmt.Println(counter())
+	fmt.Println(trace("f"))
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func main() {
+	defer fmt.Println("main is done")
+	a := [3]string{"a", "b", "c"}
+	i := 1
+	fmt.Println(a[i])
+	i -= 2
+	fmt.Println(a[i])
+}
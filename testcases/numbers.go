@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+)
+
+func main() {
+	a := 0o755
+	b := 0b1010
+	c := 1_000_000
+	d := 0x1p-2
+	e := 0xFFFFFFFF
+	f := 0755
+	fmt.Println(a, b, c, d, e+1, f)
+	fmt.Println(0x_FF, 0x1p4, 1_000.5, .5, 1e3, 0o17)
+	var g float64 = 6.02e+23
+	var h uint64 = 0xFFFFFFFFFFFFFFFF
+	fmt.Println(g, h, 2e-3)
+
+	// An untyped constant has the type of the other operand, and the
+	// arithmetic wraps around on overflow
+	var y int32 = 2147483647
+	z := y + 1
+	var i uint8 = 255
+	j := i + 1
+	var u uint32 = 0
+	w := u - 1
+	fmt.Println(z, j, w, y*2, i<<1, 1+i*2, h+1)
+	var k int16 = -32768
+	fmt.Println(k-1, -k, k/-1, (i+1)*3)
+	var x float32 = 0.1
+	fmt.Println(x*3.3, x+0.2)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "fmt"
+
+func isEven(n int) bool {
+	return n&1 == 0
+}
+
+func main() {
+	// AND NOT
+	x := 0b1111
+	x &^= 0b0101
+	y := x &^ 2
+	fmt.Println(x, y)
+
+	// Bitwise complement
+	var small uint8 = 5
+	fmt.Println(^x, ^small, ^0)
+	z := ^x & y
+	fmt.Println(z, ^(x | y), ^small&0x0f)
+
+	// Bitwise operators and shifts have a higher precedence than in C++
+	if x&3 == 2 {
+		fmt.Println("x&3 == 2")
+	}
+	fmt.Println(1<<2+1, 2*3&1, x|1^3, isEven(x))
+
+	// Compound assignment
+	n := 3
+	n += 4
+	n -= 1
+	n *= 5
+	n /= 2
+	n %= 8
+	n <<= 3
+	n >>= 1
+	n |= 1
+	n ^= 6
+	n &= 0xff
+	n++
+	n--
+	fmt.Println(n)
+
+	// Comparisons are not assignments
+	a, b := 1, 2
+	equal := a == b
+	fmt.Println(equal, isEven(a+b) != isEven(a))
+	fmt.Println(a <= b, a >= b)
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func main() {
+	// The runtime checks are found even when an assignment comes after them
+	defer fmt.Println("deferred")
+	xs := []int{1}
+	i := 5
+	fmt.Println(xs[i])
+	total := 0
+	fmt.Println(total)
+}
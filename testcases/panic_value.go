@@ -0,0 +1,19 @@
+package main
+
+import "fmt"
+
+func divide(a, b int) int {
+	if b == 0 {
+		// The value of the panic is an int
+		panic(a)
+	}
+	return a / b
+}
+
+func main() {
+	defer fmt.Println("main is done")
+	fmt.Println(divide(10, 2))
+	n := 40 + 2
+	fmt.Println(divide(n, 0))
+	fmt.Println("this is not printed")
+}
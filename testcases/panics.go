@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+func check(n int) int {
+	defer fmt.Println("check is done")
+	if n > 2 {
+		panic("too large")
+	}
+	return n
+}
+
+func main() {
+	// The deferred function calls are made before the program exits with exit status 2
+	defer fmt.Println("main is done")
+	for i := 0; i < 5; i++ {
+		fmt.Println(check(i))
+	}
+	fmt.Println("this is not printed")
+}
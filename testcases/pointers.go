@@ -0,0 +1,92 @@
+package main
+
+import "fmt"
+
+type Node struct {
+	Value int
+	Next  *Node
+}
+
+type Pair struct {
+	A, B int
+}
+
+// newCounter returns a pointer to a local variable, which outlives the call
+func newCounter(start int) *int {
+	count := start
+	return &count
+}
+
+// parameter returns a pointer to a parameter
+func parameter(n int) *int {
+	return &n
+}
+
+func increment(p *int) {
+	*p++
+}
+
+func push(head *Node, value int) *Node {
+	return &Node{Value: value, Next: head}
+}
+
+func main() {
+	p := new(int)
+	fmt.Println(*p)
+	*p = 41
+	increment(p)
+	fmt.Println(*p)
+
+	c := newCounter(10)
+	increment(c)
+	increment(c)
+	fmt.Println(*c, *parameter(7))
+
+	var list *Node
+	fmt.Println(list == nil, list)
+	for i := 1; i <= 3; i++ {
+		list = push(list, i)
+	}
+	for n := list; n != nil; n = n.Next {
+		fmt.Println(n.Value)
+	}
+	fmt.Println(list.Next.Next.Value, list.Next.Next.Next == nil)
+
+	x := 10
+	q := &x
+	r := &x
+	*q += 5
+	fmt.Println(x, *r, q == r, q != nil)
+
+	node := &Node{Value: 1}
+	node.Value = 7
+	alias := node
+	alias.Value++
+	fmt.Println(node.Value, node)
+
+	var pair Pair
+	b := &pair.B
+	*b = 3
+	pp := &pair
+	pp.A = 2
+	fmt.Println(pair, *pp)
+
+	nodes := []*Node{{Value: 5}, node}
+	nodes[0].Value *= 2
+	fmt.Println(nodes[0].Value, nodes[1].Value)
+
+	empty := (*Node)(nil)
+	fmt.Println(empty == nil)
+
+	// The variables in different scopes have different types
+	for p := push(node, 7); p != nil; p = p.Next {
+		fmt.Println("pointer", p.Value)
+	}
+	if node != nil {
+		p := Node{Value: 8}
+		p.Value++
+		fmt.Println("value", p.Value)
+	}
+	*p = 9
+	fmt.Println(*p)
+}
@@ -0,0 +1,54 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+type Segment struct {
+	From, To Point
+	Name     string
+}
+
+// Path can be compared, since arrays of structs can be compared
+type Path struct {
+	Points [2]Point
+}
+
+// Tagged can not be compared, since it has a slice field
+type Tagged struct {
+	Name string
+	Tags []string
+}
+
+func main() {
+	a := Point{1, 2}
+	b := Point{Y: 2, X: 1}
+	fmt.Println(a == b, a != Point{}, a == Point{2, 1})
+
+	s1 := Segment{a, b, "s"}
+	s2 := s1
+	s2.Name = "t"
+	fmt.Println(s1 == s2, s1.From == s2.To)
+
+	// Structs can be map keys
+	visits := map[Point]int{}
+	visits[Point{1, 2}]++
+	visits[b]++
+	visits[Point{3, 4}] = 7
+	fmt.Println(visits[a], visits[Point{3, 4}], len(visits))
+
+	names := map[Segment]string{s1: "first", s2: "second"}
+	fmt.Println(names[s1], names[Segment{a, a, "t"}], len(names))
+
+	// Structs with arrays, and arrays of structs, can be map keys
+	lengths := map[Path]int{}
+	lengths[Path{[2]Point{a, {3, 4}}}] = 5
+	lengths[Path{[2]Point{{3, 4}, a}}] = 6
+	ends := map[[2]Point]string{{a, b}: "same"}
+	fmt.Println(lengths[Path{[2]Point{a, {3, 4}}}], len(lengths), ends[[2]Point{b, a}])
+
+	t := Tagged{Name: "x", Tags: []string{"a"}}
+	fmt.Println(t.Name, len(t.Tags))
+}
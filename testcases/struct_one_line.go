@@ -0,0 +1,43 @@
+package main
+
+import "fmt"
+
+// Struct types that are declared on one line
+
+type P struct{ X, Y int }
+
+// Types with the same fields are different types
+type (
+	Feet   struct{ V int }
+	Meters struct{ V int }
+)
+
+type Empty struct{}
+
+func (p P) Sum() int {
+	return p.X + p.Y
+}
+
+func (p *P) Scale(k int) {
+	p.X *= k
+	p.Y *= k
+}
+
+func (m Meters) ToFeet() Feet {
+	return Feet{m.V * 3}
+}
+
+func (f Feet) Inches() int {
+	return f.V * 12
+}
+
+func main() {
+	type Local struct{ Name string }
+	p := P{1, 2}
+	p.Scale(10)
+	fmt.Println(p, p.Sum())
+	f := Meters{2}.ToFeet()
+	fmt.Println(f.V, f.Inches(), Empty{}, Local{"x"})
+	m := map[P]string{{10, 20}: "a"}
+	fmt.Println(m[p], p == P{10, 20})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+)
+
+func sign(x int) int {
+	return x - 3
+}
+
+func main() {
+	for i := 0; i < 6; i++ {
+		switch i {
+		case 0, 2, 4:
+			fmt.Println(i, "is even")
+		case 1, 3:
+			fmt.Println(i, "is odd")
+			if i == 3 {
+				break
+			}
+			fmt.Println("not three")
+		default:
+			fmt.Println(i, "is something else")
+		}
+	}
+	x := 7
+	switch {
+	case x > 5 && x < 10:
+		fmt.Println("between five and ten")
+		fallthrough
+	case x > 100:
+		fmt.Println("fell through")
+	case x < 0:
+		fmt.Println("negative")
+	}
+	switch y := sign(x); y {
+	default:
+		fmt.Println("default first", y)
+	case 1:
+		fmt.Println("one")
+	}
+	switch s := "outer"; s {
+	case "outer":
+		switch t := "inner"; t {
+		case "inner":
+			fmt.Println(s, t)
+			break
+		}
+		fmt.Println("after the inner switch")
+	}
+	count := 0
+	for {
+		count++
+		switch {
+		case count < 3:
+			continue
+		}
+		break
+	}
+	fmt.Println("count is", count)
+	switch x {
+	}
+	switch {
+	default:
+		fmt.Println("only default")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// Tests var with several names
+
+import "fmt"
+
+var width, height int = 640, 480
+
+var (
+	first, last string
+	total       = 3
+)
+
+func describe() (string, int) {
+	return "box", 3
+}
+
+var name, size = describe()
+
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+// results returns pointers to variables that are given the results of a function call
+func results() (*int, *int) {
+	var q, r = divmod(23, 5)
+	return &q, &r
+}
+
+func main() {
+	var a, b int
+	var c, d = 1.5, "x"
+	var s, t []int
+	s = append(s, 1)
+	p := &b
+	*p = 7
+	fmt.Println(a, b, c, d, s, t == nil)
+	fmt.Println(width, height, first == last, total)
+	var q, r = divmod(17, 5)
+	var _, m = divmod(9, 4)
+	var x, y = divmod(r, 2)
+	px := &x
+	*px += y
+	fmt.Println(name, size, q, r, m, x, y)
+	pq, pr := results()
+	fmt.Println(*pq, *pr)
+}
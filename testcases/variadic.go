@@ -0,0 +1,76 @@
+package main
+
+import "fmt"
+
+func sum(nums ...int) int {
+	total := 0
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+func join(separator string, words ...string) string {
+	result := ""
+	for i, word := range words {
+		if i > 0 {
+			result += separator
+		}
+		result += word
+	}
+	return result
+}
+
+// The slice is passed on as it is, so changes are visible to the caller
+func reset(nums ...int) {
+	if len(nums) > 0 {
+		nums[0] = 0
+	}
+}
+
+func main() {
+	fmt.Println(sum(), sum(1), sum(1, 2, 3))
+	fmt.Println(join(", ", "a", "b", "c"))
+	fmt.Println(join("-"))
+
+	xs := []int{4, 5, 6}
+	fmt.Println(sum(xs...))
+	reset(xs...)
+	fmt.Println(xs, len(xs))
+
+	// The arguments are copied to a new slice when they are given one by one
+	reset(xs[1], xs[2])
+	fmt.Println(xs)
+
+	// Appending single elements and slices
+	xs = append(xs, 7)
+	xs = append(xs, 8, 9)
+	ys := []int{10, 11}
+	xs = append(xs, ys...)
+	fmt.Println(xs, len(xs))
+
+	var words []string
+	words = append(words, "x", "y")
+	fmt.Println(words, len(words), words == nil)
+	fmt.Println(join("+", words...))
+
+	// Variadic calls as arguments of variadic calls
+	fmt.Println(sum(sum(1, 2), 3), join(" ", join("", "a", "b"), "c"))
+
+	// Passing on a part of a slice
+	fmt.Println(sum(xs[1:]...), sum(xs[:2]...), sum(xs[2:4]...))
+	reset(xs[3:]...)
+	fmt.Println(xs)
+
+	// Slices of a slice share the array, up to the capacity
+	zs := xs[1:3]
+	fmt.Println(zs, len(zs), cap(zs) == cap(xs)-1)
+	zs = append(zs, 100)
+	fmt.Println(xs[3], zs)
+	limited := xs[1:3:3]
+	limited = append(limited, 200)
+	fmt.Println(xs[3], limited, len(xs[:]))
+
+	name := "go2cpp"
+	fmt.Println(name[:2], name[3:], name[2:3])
+}
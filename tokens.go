@@ -0,0 +1,63 @@
+package main
+
+// Tokenizing code with go/scanner, so that the literals and the comments are
+// recognized in the same way by all the transformations of a line
+
+import (
+	"go/scanner"
+	"go/token"
+)
+
+// lineToken is a token in a string of code
+type lineToken struct {
+	pos, end int // the position of the token in the code, and the position right after it
+	tok      token.Token
+}
+
+// scannedTokens are the tokens of the strings of code that have been
+// scanned while transforming the current line, by code
+var scannedTokens = map[string][]lineToken{}
+
+// tokens returns the tokens of a string of Go code, or of C++ code that is
+// transformed from Go code, including the comments. A string is only
+// scanned once while a line is transformed.
+func tokens(code string) []lineToken {
+	if result, ok := scannedTokens[code]; ok {
+		return result
+	}
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(code))
+	// The C++ code may contain characters that are not valid Go, like # and ?
+	s.Init(file, []byte(code), func(token.Position, string) {}, scanner.ScanComments)
+	var result []lineToken
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			// Not in the code, but inserted at the end of a line
+			continue
+		}
+		start := file.Offset(pos)
+		end := start + len(tok.String())
+		if lit != "" {
+			end = start + len(lit)
+		}
+		result = append(result, lineToken{start, min(end, len(code)), tok})
+	}
+	scannedTokens[code] = result
+	return result
+}
+
+// isName checks if the token is an identifier or a keyword
+func (t lineToken) isName() bool {
+	return t.tok == token.IDENT || t.tok.IsKeyword()
+}
+
+// selected checks if the token in the given code comes right after a period,
+// like the name of a field or a method
+func (t lineToken) selected(code string) bool {
+	return t.pos > 0 && code[t.pos-1] == '.'
+}